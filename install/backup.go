@@ -0,0 +1,659 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// backupDatabaseEntry is the path of the Pangolin SQLite database inside a backup archive
+const backupDatabaseEntry = "config/db/db.sqlite"
+
+// backupManifestEntry is the path of the version manifest inside a backup archive
+const backupManifestEntry = "manifest.json"
+
+// backupComposeEntry is the path of the compose file inside a backup archive, wherever
+// --compose-file keeps it on the host
+const backupComposeEntry = "docker-compose.yml"
+
+// backupManifest records what a backup archive was taken of
+type backupManifest struct {
+	CreatedAt       string `json:"created_at"`
+	PangolinVersion string `json:"pangolin_version"`
+	GerbilVersion   string `json:"gerbil_version"`
+	BadgerVersion   string `json:"badger_version"`
+	// ComposeFile is the --compose-file the backup was taken with
+	ComposeFile string `json:"compose_file,omitempty"`
+	// DbBackend is the database of the installation, a postgres backup has no database file
+	DbBackend string `json:"db_backend,omitempty"`
+}
+
+// requiredBackupEntries lists the files a backup must contain to be restorable. The SQLite
+// database is required on top for installations that keep their data in it.
+var requiredBackupEntries = []string{
+	"config/config.yml",
+	"config/traefik/traefik_config.yml",
+	"config/traefik/dynamic_config.yml",
+}
+
+// backupDbBackend returns the database of a backed up installation from its manifest or, for
+// archives without one in the manifest, from its config.yml
+func backupDbBackend(manifest []byte, appConfig []byte) string {
+	var m backupManifest
+	if json.Unmarshal(manifest, &m) == nil && m.DbBackend != "" {
+		return m.DbBackend
+	}
+	var app installedAppConfig
+	if yaml.Unmarshal(appConfig, &app) == nil && app.Postgres != nil {
+		return dbBackendPostgres
+	}
+	return dbBackendSQLite
+}
+
+// verifyBackup opens a backup archive, lists its contents and checks that the
+// config and database entries are present, non-empty and intact.
+func verifyBackup(archivePath string, report *Report) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip stream: %v", err)
+	}
+	defer gzipReader.Close()
+
+	// Keep a temporary copy of the database so it can be checked after the walk
+	dbFile, err := os.CreateTemp("", "pangolin-backup-*.sqlite")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary database copy: %v", err)
+	}
+	defer os.Remove(dbFile.Name())
+	defer dbFile.Close()
+
+	sizes := make(map[string]int64)
+	var manifest, appConfig []byte
+
+	report.Columns = []string{"entry", "size"}
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if header.Typeflag == tar.TypeDir {
+			report.AddRow(name+"/", "-")
+			continue
+		}
+		report.AddRow(name, fmt.Sprint(header.Size))
+		sizes[name] = header.Size
+
+		switch name {
+		case backupDatabaseEntry:
+			if _, err := io.Copy(dbFile, tarReader); err != nil {
+				return fmt.Errorf("failed to extract %s: %v", name, err)
+			}
+		case backupManifestEntry:
+			if manifest, err = io.ReadAll(tarReader); err != nil {
+				return fmt.Errorf("failed to extract %s: %v", name, err)
+			}
+		case "config/config.yml":
+			if appConfig, err = io.ReadAll(tarReader); err != nil {
+				return fmt.Errorf("failed to extract %s: %v", name, err)
+			}
+		}
+	}
+
+	required := requiredBackupEntries
+	sqlite := backupDbBackend(manifest, appConfig) != dbBackendPostgres
+	if sqlite {
+		required = append(required[:len(required):len(required)], backupDatabaseEntry)
+	} else {
+		report.AddSkipped("database", "the installation uses PostgreSQL, back it up with pg_dump")
+	}
+
+	problems := 0
+	for _, entry := range required {
+		size, ok := sizes[entry]
+		switch {
+		case !ok:
+			report.AddCheck(entry, false, "missing")
+			problems++
+		case size == 0:
+			report.AddCheck(entry, false, "empty")
+			problems++
+		default:
+			report.AddCheck(entry, true, "present")
+		}
+	}
+
+	integrityChecked := true
+	if sqlite && sizes[backupDatabaseEntry] > 0 {
+		fullCheck, err := checkSQLiteIntegrity(dbFile.Name())
+		if err != nil {
+			report.AddCheck("database integrity", false, err.Error())
+			problems++
+		} else if fullCheck {
+			report.AddCheck("database integrity", true, "PRAGMA integrity_check returned ok")
+		} else {
+			integrityChecked = false
+			report.AddSkipped("database integrity", "not checked (sqlite3 missing), only the SQLite header is valid")
+			report.Warn("sqlite3 is not installed, install it to check the integrity of the database")
+		}
+	}
+
+	if problems > 0 {
+		report.Message = "Backup verification FAILED"
+		return fmt.Errorf("%d problem(s) found in %s", problems, archivePath)
+	}
+
+	if !integrityChecked {
+		report.Message = "Backup verification INCOMPLETE: the files are present, the database integrity was not checked"
+		// An unchecked database is not a pass for scripts relying on the exit code
+		if !*allowUncheckedFlag {
+			return fmt.Errorf("the database integrity of %s was not checked, install sqlite3 or pass --allow-unchecked", archivePath)
+		}
+		return nil
+	}
+	report.Message = "Backup verification PASSED"
+	return nil
+}
+
+// checkSQLiteIntegrity validates the SQLite header and, when the sqlite3 CLI is
+// available, runs PRAGMA integrity_check against the given database copy.
+// fullCheck is false when only the header could be checked.
+func checkSQLiteIntegrity(dbPath string) (fullCheck bool, err error) {
+	file, err := os.Open(dbPath)
+	if err != nil {
+		return false, err
+	}
+	header := make([]byte, 16)
+	_, err = io.ReadFull(file, header)
+	file.Close()
+	if err != nil || !bytes.Equal(header, []byte("SQLite format 3\x00")) {
+		return false, fmt.Errorf("not a SQLite database")
+	}
+
+	if _, err := exec.LookPath("sqlite3"); err != nil {
+		return false, nil
+	}
+
+	output, err := exec.Command("sqlite3", dbPath, "PRAGMA integrity_check;").CombinedOutput()
+	if err != nil {
+		return false, fmt.Errorf("sqlite3 failed: %v", err)
+	}
+	if result := strings.TrimSpace(string(output)); result != "ok" {
+		return false, fmt.Errorf("%s", result)
+	}
+
+	return true, nil
+}
+
+// createBackup writes a timestamped archive of config/ and the compose file to outDir and
+// returns its path. Running containers are optionally stopped for a consistent snapshot.
+func createBackup(outDir string, reader *bufio.Reader) (string, error) {
+	if _, err := os.Stat("config"); err != nil {
+		return "", fmt.Errorf("config directory not found, run the backup from the installation directory")
+	}
+
+	if err := os.MkdirAll(outDir, 0700); err != nil {
+		return "", fmt.Errorf("output directory %s is not writable: %v", outDir, err)
+	}
+	probe, err := os.CreateTemp(outDir, ".pangolin-backup-*")
+	if err != nil {
+		return "", fmt.Errorf("output directory %s is not writable: %v", outDir, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	// An output directory inside config/ is left out of the archive, so neither the archive
+	// being written nor the older backups end up in it
+	outInfo, err := os.Stat(outDir)
+	if err != nil {
+		return "", fmt.Errorf("output directory %s is not accessible: %v", outDir, err)
+	}
+	if configInfo, err := os.Stat("config"); err == nil && os.SameFile(outInfo, configInfo) {
+		return "", fmt.Errorf("output directory %s is the config directory being backed up, choose another one", outDir)
+	}
+
+	if isStackRunning() && confirm(reader, "stop-containers", "The containers are running. Stop them for a consistent snapshot?", true) {
+		containerType := detectContainerType()
+		if err := stopContainers(containerType); err != nil {
+			return "", err
+		}
+		defer func() {
+			if err := startContainers(containerType); err != nil {
+				logError("Error restarting the containers: %v", err)
+			}
+		}()
+	}
+
+	var versions Config
+	loadVersions(&versions)
+	dbBackend := dbBackendSQLite
+	var app installedAppConfig
+	if err := readYAMLFile("config/config.yml", &app); err == nil && app.Postgres != nil {
+		dbBackend = dbBackendPostgres
+		logWarn("Warning: the PostgreSQL database is not part of the backup, back it up with pg_dump.")
+	}
+	now := time.Now()
+	manifest, err := json.MarshalIndent(backupManifest{
+		CreatedAt:       now.UTC().Format(time.RFC3339),
+		PangolinVersion: versions.PangolinVersion,
+		GerbilVersion:   versions.GerbilVersion,
+		BadgerVersion:   versions.BadgerVersion,
+		ComposeFile:     *composeFileFlag,
+		DbBackend:       dbBackend,
+	}, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to encode the manifest: %v", err)
+	}
+
+	file, archivePath, err := createBackupFile(outDir, now)
+	if err != nil {
+		return "", err
+	}
+	// writeBackupArchive closes the file once it is complete and reports a failing close
+	if err := writeBackupArchive(file, manifest, *composeFileFlag, outInfo); err != nil {
+		file.Close()
+		os.Remove(archivePath)
+		return "", err
+	}
+	return archivePath, nil
+}
+
+// createBackupFile creates the archive file of a backup taken at now. The name has second
+// resolution, so a counter is appended when a backup of the same second already exists.
+func createBackupFile(outDir string, now time.Time) (*os.File, string, error) {
+	base := "pangolin-backup-" + now.Format("20060102-150405")
+	for i := 1; ; i++ {
+		name := base + ".tar.gz"
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d.tar.gz", base, i)
+		}
+		archivePath := filepath.Join(outDir, name)
+		file, err := os.OpenFile(archivePath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			return file, archivePath, nil
+		}
+		if !os.IsExist(err) {
+			return nil, "", fmt.Errorf("failed to create archive: %v", err)
+		}
+	}
+}
+
+// writeBackupArchive writes the manifest, config/ except the directory skipDir and composeFile
+// into file as a tar.gz archive and closes file when it succeeds. On failure the caller closes file.
+func writeBackupArchive(file *os.File, manifest []byte, composeFile string, skipDir os.FileInfo) error {
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if err := tarWriter.WriteHeader(&tar.Header{
+		Name:    backupManifestEntry,
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return fmt.Errorf("failed to write the manifest: %v", err)
+	}
+	if _, err := tarWriter.Write(manifest); err != nil {
+		return fmt.Errorf("failed to write the manifest: %v", err)
+	}
+
+	err := filepath.WalkDir("config", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if info, err := d.Info(); err == nil && os.SameFile(info, skipDir) {
+				return filepath.SkipDir
+			}
+		}
+		return addToArchive(tarWriter, name, filepath.ToSlash(name), d)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to archive config: %v", err)
+	}
+	if info, err := os.Stat(composeFile); err == nil {
+		if err := addToArchive(tarWriter, composeFile, backupComposeEntry, fs.FileInfoToDirEntry(info)); err != nil {
+			return fmt.Errorf("failed to archive %s: %v", composeFile, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to finish archive: %v", err)
+	}
+	return file.Close()
+}
+
+// addToArchive writes the file or directory name as the archive entry, skipping sockets and
+// other special files
+func addToArchive(tarWriter *tar.Writer, name string, entry string, d fs.DirEntry) error {
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() && !info.IsDir() {
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	header.Name = entry
+	if info.IsDir() {
+		header.Name += "/"
+	}
+	if err := tarWriter.WriteHeader(header); err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return nil
+	}
+
+	source, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	_, err = io.Copy(tarWriter, source)
+	return err
+}
+
+// readBackupManifest returns the manifest of an archive created by --backup
+func readBackupManifest(archivePath string) (*backupManifest, error) {
+	var manifest *backupManifest
+	err := walkBackupArchive(archivePath, func(name string, header *tar.Header, r io.Reader) error {
+		if name != backupManifestEntry {
+			return nil
+		}
+		manifest = &backupManifest{}
+		if err := json.NewDecoder(r).Decode(manifest); err != nil {
+			return fmt.Errorf("invalid %s: %v", backupManifestEntry, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("%s has no %s, it was not created by --backup", archivePath, backupManifestEntry)
+	}
+	return manifest, nil
+}
+
+// walkBackupArchive calls fn for every entry of a backup archive. Entries outside of
+// config/, the compose file and the manifest are rejected.
+func walkBackupArchive(archivePath string, fn func(name string, header *tar.Header, r io.Reader) error) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %v", err)
+	}
+	defer file.Close()
+
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		return fmt.Errorf("failed to read gzip stream: %v", err)
+	}
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if name != backupManifestEntry && name != backupComposeEntry && name != "config" && !strings.HasPrefix(name, "config/") {
+			return fmt.Errorf("unexpected entry %q in archive", header.Name)
+		}
+		if err := fn(name, header, tarReader); err != nil {
+			return err
+		}
+	}
+}
+
+// compareVersions compares two dotted versions like 1.2.3 or v1.2.3. ok is false if either
+// one cannot be parsed.
+func compareVersions(a, b string) (result int, ok bool) {
+	partsA := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	partsB := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(partsA) || i < len(partsB); i++ {
+		var numA, numB int
+		var err error
+		if i < len(partsA) {
+			if numA, err = strconv.Atoi(partsA[i]); err != nil {
+				return 0, false
+			}
+		}
+		if i < len(partsB) {
+			if numB, err = strconv.Atoi(partsB[i]); err != nil {
+				return 0, false
+			}
+		}
+		if numA != numB {
+			if numA < numB {
+				return -1, true
+			}
+			return 1, true
+		}
+	}
+	return 0, true
+}
+
+// restoreBackup extracts an archive created by --backup into the current directory, with the
+// compose file at --compose-file, and starts the stack
+func restoreBackup(archivePath string, reader *bufio.Reader) error {
+	manifest, err := readBackupManifest(archivePath)
+	if err != nil {
+		return err
+	}
+	logInfo("Backup created at %s with Pangolin %s, Gerbil %s and Badger %s",
+		manifest.CreatedAt, manifest.PangolinVersion, manifest.GerbilVersion, manifest.BadgerVersion)
+
+	// The database can be migrated forward but not back, so a backup from a newer Pangolin is refused
+	var versions Config
+	loadVersions(&versions)
+	switch result, ok := compareVersions(manifest.PangolinVersion, versions.PangolinVersion); {
+	case manifest.PangolinVersion == versions.PangolinVersion:
+	case !ok:
+		logWarn("Warning: could not compare the backup's Pangolin version %s with this installer's %s", manifest.PangolinVersion, versions.PangolinVersion)
+	case result > 0 && !*forceFlag:
+		return fmt.Errorf("the backup is from Pangolin %s, which is newer than the %s this installer deploys (use --force to restore anyway)", manifest.PangolinVersion, versions.PangolinVersion)
+	case result != 0:
+		logWarn("Warning: the backup is from Pangolin %s, this installer deploys %s", manifest.PangolinVersion, versions.PangolinVersion)
+	}
+
+	// The recorded path is only followed inside the current directory, an archive must not be
+	// able to write elsewhere on the host
+	composeFile := *composeFileFlag
+	if manifest.ComposeFile != "" && manifest.ComposeFile != composeFile && !isFlagSet("compose-file") {
+		if filepath.IsLocal(manifest.ComposeFile) {
+			composeFile = manifest.ComposeFile
+			flag.Set("compose-file", composeFile)
+		} else {
+			logWarn("Warning: the backup was taken with --compose-file %s, restoring the compose file to %s instead (pass --compose-file to choose).", manifest.ComposeFile, composeFile)
+		}
+	}
+
+	var existing []string
+	for _, target := range []string{"config", composeFile} {
+		if _, err := os.Lstat(target); err == nil {
+			existing = append(existing, target)
+		}
+	}
+	if len(existing) > 0 {
+		if !*forceFlag {
+			return fmt.Errorf("refusing to overwrite the existing %s, pass --force to restore over them", strings.Join(existing, " and "))
+		}
+		logWarn("WARNING: restoring will OVERWRITE the existing %s, including the database and certificates!", strings.Join(existing, " and "))
+		if !*quietFlag && !readBool(reader, "Are you sure you want to overwrite the current installation?", false) {
+			return fmt.Errorf("restore cancelled")
+		}
+	}
+
+	logStep("Restoring Backup")
+	err = walkBackupArchive(archivePath, func(name string, header *tar.Header, r io.Reader) error {
+		if name == backupManifestEntry {
+			return nil
+		}
+		if name == backupComposeEntry {
+			name = composeFile
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			return os.MkdirAll(name, 0755)
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode).Perm())
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, r); err != nil {
+				out.Close()
+				return err
+			}
+			return out.Close()
+		default:
+			return fmt.Errorf("unsupported entry type for %s", name)
+		}
+	})
+	if err != nil {
+		return fmt.Errorf("failed to extract the backup: %v", err)
+	}
+	logInfo("Backup extracted.")
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed, start the stack manually")
+	}
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	return startContainers(containerType)
+}
+
+// backupArchive is an archive created by --backup, found in a backup directory
+type backupArchive struct {
+	Path      string
+	Size      int64
+	CreatedAt time.Time
+	Manifest  *backupManifest
+}
+
+// findBackups returns the archives in dir that carry a backup manifest, newest first by the
+// creation time in the manifest. Other .tar.gz files are returned as skipped.
+func findBackups(dir string) (backups []backupArchive, skipped []string, err error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read the backup directory: %v", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tar.gz") {
+			continue
+		}
+		archivePath := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			skipped = append(skipped, archivePath)
+			continue
+		}
+		manifest, err := readBackupManifest(archivePath)
+		if err != nil {
+			skipped = append(skipped, archivePath)
+			continue
+		}
+		createdAt, err := time.Parse(time.RFC3339, manifest.CreatedAt)
+		if err != nil {
+			skipped = append(skipped, archivePath)
+			continue
+		}
+		backups = append(backups, backupArchive{Path: archivePath, Size: info.Size(), CreatedAt: createdAt, Manifest: manifest})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].CreatedAt.After(backups[j].CreatedAt) })
+	return backups, skipped, nil
+}
+
+// listBackups fills the report with the backups in dir and the versions they were taken of
+func listBackups(dir string, report *Report) error {
+	backups, skipped, err := findBackups(dir)
+	if err != nil {
+		return err
+	}
+
+	report.Columns = []string{"created", "archive", "size", "pangolin", "gerbil", "badger"}
+	for _, backup := range backups {
+		report.AddRow(backup.CreatedAt.Local().Format("2006-01-02 15:04:05"), filepath.Base(backup.Path), strconv.FormatInt(backup.Size, 10),
+			backup.Manifest.PangolinVersion, backup.Manifest.GerbilVersion, backup.Manifest.BadgerVersion)
+	}
+	for _, archivePath := range skipped {
+		report.Warn("%s has no valid backup manifest, skipped", archivePath)
+	}
+	report.Message = fmt.Sprintf("%d backup(s) in %s", len(backups), dir)
+	return nil
+}
+
+// pruneBackups deletes all but the newest keep backups in dir after confirming. Archives
+// without a backup manifest were not written by --backup and are never deleted.
+func pruneBackups(dir string, keep int, reader *bufio.Reader) error {
+	backups, _, err := findBackups(dir)
+	if err != nil {
+		return err
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	prune := backups[keep:]
+	logInfo("Keeping the newest %d backup(s), these are older:", keep)
+	for _, backup := range prune {
+		logInfo("  %s (%s)", filepath.Base(backup.Path), backup.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+	}
+	if !confirm(reader, "force", fmt.Sprintf("Delete these %d backup(s)?", len(prune)), false) {
+		logInfo("Kept the older backups.")
+		return nil
+	}
+
+	for _, backup := range prune {
+		if err := os.Remove(backup.Path); err != nil {
+			return fmt.Errorf("failed to delete %s: %v", backup.Path, err)
+		}
+		logInfo("Deleted %s", backup.Path)
+	}
+	return nil
+}
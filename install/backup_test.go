@@ -0,0 +1,88 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCreateBackupSkipsOutputDirInsideConfig(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for path, content := range map[string]string{
+		"config/config.yml":                 "server:\n  secret: \"test\"\n",
+		"config/traefik/traefik_config.yml": "log:\n  level: INFO\n",
+		"config/backups/older.tar.gz":       "an older backup",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	reader := bufio.NewReader(strings.NewReader(""))
+	first, err := createBackup("config/backups", reader)
+	if err != nil {
+		t.Fatalf("first backup: %v", err)
+	}
+	second, err := createBackup("config/backups", reader)
+	if err != nil {
+		t.Fatalf("second backup: %v", err)
+	}
+	if first == second {
+		t.Fatalf("both backups were written to %s", first)
+	}
+
+	entries := backupEntries(t, second)
+	for _, entry := range entries {
+		if strings.HasPrefix(entry, "config/backups") {
+			t.Errorf("the backup contains %s from its own output directory", entry)
+		}
+	}
+	for _, want := range []string{backupManifestEntry, "config/config.yml", "config/traefik/traefik_config.yml"} {
+		found := false
+		for _, entry := range entries {
+			found = found || entry == want
+		}
+		if !found {
+			t.Errorf("the backup is missing %s, it has %q", want, entries)
+		}
+	}
+
+	if _, err := createBackup("config", reader); err == nil {
+		t.Error("createBackup accepted config/ itself as the output directory")
+	}
+}
+
+// backupEntries returns the names of the entries in a backup archive
+func backupEntries(t *testing.T, archivePath string) []string {
+	t.Helper()
+	file, err := os.Open(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gzipReader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var entries []string
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		if err != nil {
+			t.Fatalf("reading %s: %v", archivePath, err)
+		}
+		entries = append(entries, header.Name)
+	}
+}
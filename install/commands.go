@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// parseCommandArgs parses the flags given after the subcommand, which flag.Parse leaves
+// unparsed because it stops at the first non-flag argument, and returns the positional
+// arguments. Everything after "--" is positional.
+func parseCommandArgs(args []string) ([]string, error) {
+	var positional []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, positional = args[:i], args[i+1:]
+	}
+
+	var leading []string
+	for len(args) > 0 {
+		if !strings.HasPrefix(args[0], "-") || args[0] == "-" {
+			leading = append(leading, args[0])
+			args = args[1:]
+			continue
+		}
+		if err := flag.CommandLine.Parse(args); err != nil {
+			return nil, err
+		}
+		args = flag.Args()
+	}
+	return append(leading, positional...), nil
+}
+
+// runCommand dispatches the installer subcommands and returns the process exit code.
+func runCommand(args []string) int {
+	report := newReport(args[0])
+
+	switch args[0] {
+	case "verify-backup":
+		if len(args) != 2 {
+			// Usage errors go through the report too, so --report-format json stays JSON
+			report.Finish(fmt.Errorf("usage: installer verify-backup <archive>"))
+			report.Print()
+			return 2
+		}
+		report.Finish(verifyBackup(args[1], report))
+	case "test-dns-provider":
+		report.Finish(runTestDNSProviderCommand(args[1:], report))
+	case "config":
+		report.Finish(runConfigCommand(args[1:], report))
+	default:
+		report.Finish(fmt.Errorf("unknown command: %s", args[0]))
+		report.Print()
+		return 2
+	}
+
+	report.Print()
+	if !report.Success {
+		return 1
+	}
+	return 0
+}
+
+// runConfigCommand handles the "config save|use|list" profile subcommands.
+func runConfigCommand(args []string, report *Report) error {
+	usage := fmt.Errorf("usage: installer config save <name> | use <name> | list")
+	if len(args) == 0 {
+		return usage
+	}
+	report.Command = "config " + args[0]
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		return listProfiles(report)
+	case args[0] == "save" && len(args) == 2:
+		return saveProfile(args[1], report)
+	case args[0] == "use" && len(args) == 2:
+		return useProfile(args[1], report)
+	default:
+		return usage
+	}
+}
+
+// runTestDNSProviderCommand validates the --dns-provider credentials against the base domain,
+// taken from the argument or the existing config/config.yml.
+func runTestDNSProviderCommand(args []string, report *Report) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: installer --dns-provider <name> test-dns-provider [base-domain]")
+	}
+	if *dnsProviderFlag == "" {
+		return fmt.Errorf("--dns-provider is required, must be one of %s", strings.Join(dnsProviderNames(), ", "))
+	}
+
+	var baseDomain string
+	if len(args) == 1 {
+		baseDomain = args[0]
+	} else {
+		appConfig, err := ReadAppConfig("config/config.yml")
+		if err != nil {
+			return fmt.Errorf("pass the base domain or run from an install directory: %v", err)
+		}
+		baseDomain = appConfig.BaseDomain
+	}
+	if baseDomain == "" {
+		return fmt.Errorf("could not determine the base domain")
+	}
+
+	return testDNSProvider(*dnsProviderFlag, baseDomain, report)
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// component is an optional part of the stack that is chosen in the component selection
+type component struct {
+	Name    string
+	Label   string
+	Enabled func(config *Config) bool
+	Set     func(config *Config, enabled bool)
+	// TemplateDir holds the templates only this component renders, as an overlay merged into
+	// an existing installation. Components without one are switched inside the base templates.
+	TemplateDir string
+	// Overlay reports whether the render pass only renders the overlay of this component
+	Overlay func(config *Config) bool
+}
+
+// components lists the optional components in the order they are shown
+var components = []component{
+	{
+		Name:    "gerbil",
+		Label:   "Gerbil, tunneled connections over WireGuard",
+		Enabled: func(config *Config) bool { return config.InstallGerbil },
+		Set:     func(config *Config, enabled bool) { config.InstallGerbil = enabled },
+	},
+	{
+		Name:    "email",
+		Label:   "Email (SMTP) for invites and verification",
+		Enabled: func(config *Config) bool { return config.EnableEmail },
+		Set:     func(config *Config, enabled bool) { config.EnableEmail = enabled },
+	},
+	{
+		Name:        "crowdsec",
+		Label:       "CrowdSec, managed by you after the install",
+		Enabled:     func(config *Config) bool { return config.InstallCrowdsec },
+		Set:         func(config *Config, enabled bool) { config.InstallCrowdsec = enabled },
+		TemplateDir: "config/crowdsec",
+		Overlay:     func(config *Config) bool { return config.DoCrowdsecInstall },
+	},
+}
+
+// componentNames returns the names accepted by --components
+func componentNames() []string {
+	names := make([]string, 0, len(components))
+	for _, c := range components {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+// parseComponents splits a --components value into the set of selected component names
+func parseComponents(value string) (map[string]bool, error) {
+	selected := make(map[string]bool)
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "none" {
+			continue
+		}
+		known := false
+		for _, c := range components {
+			known = known || c.Name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown component %q, must be one of %s or none", name, strings.Join(componentNames(), ", "))
+		}
+		selected[name] = true
+	}
+	return selected, nil
+}
+
+// applyComponents enables exactly the components named in selected
+func applyComponents(config *Config, selected map[string]bool) {
+	for _, c := range components {
+		c.Set(config, selected[c.Name])
+	}
+}
+
+// selectComponents shows the optional components with their state and lets the user toggle
+// them until they confirm with an empty input. --components answers it without asking.
+func selectComponents(reader *bufio.Reader, config *Config) {
+	if isFlagSet("components") {
+		selected, _ := parseComponents(*componentsFlag)
+		applyComponents(config, selected)
+		return
+	}
+	// The defaults were accepted without asking, there is nothing to toggle
+	if *yesFlag {
+		return
+	}
+
+	for {
+		logStep("Components")
+		for i, c := range components {
+			mark := " "
+			if c.Enabled(config) {
+				mark = "x"
+			}
+			fmt.Printf("%2d) [%s] %s\n", i+1, mark, c.Label)
+		}
+
+		input := readString(reader, "Enter a number to toggle that component, or press Enter to continue", "")
+		if input == "" || stdinClosed {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(input, ")"))
+		if err != nil || n < 1 || n > len(components) {
+			fmt.Printf("Invalid value: enter a number between 1 and %d\n", len(components))
+			continue
+		}
+		c := components[n-1]
+		c.Set(config, !c.Enabled(config))
+	}
+}
+
+// templateSelected reports whether a render pass for config renders the embedded template path.
+// A component overlay pass renders only the templates of that component, every other pass
+// renders the base templates and leaves out the overlays.
+func templateSelected(path string, config *Config) bool {
+	overlayPass := false
+	for _, c := range components {
+		if c.TemplateDir == "" {
+			continue
+		}
+		if path == c.TemplateDir || strings.HasPrefix(path, c.TemplateDir+"/") {
+			return c.Overlay(config)
+		}
+		overlayPass = overlayPass || c.Overlay(config)
+	}
+	return !overlayPass
+}
@@ -3,8 +3,10 @@ package main
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
+	"path/filepath"
 	"strings"
 
 	"gopkg.in/yaml.v3"
@@ -22,7 +24,11 @@ type TraefikConfig struct {
 	CertificatesResolvers struct {
 		LetsEncrypt struct {
 			Acme struct {
-				Email string `yaml:"email"`
+				Email        string `yaml:"email"`
+				CAServer     string `yaml:"caServer"`
+				DNSChallenge struct {
+					Provider string `yaml:"provider"`
+				} `yaml:"dnsChallenge"`
 			} `yaml:"acme"`
 		} `yaml:"letsencrypt"`
 	} `yaml:"certificatesResolvers"`
@@ -42,6 +48,9 @@ type TraefikConfigValues struct {
 	DashboardDomain  string
 	LetsEncryptEmail string
 	BadgerVersion    string
+	// DNSProvider is set when the certificates use the DNS-01 challenge
+	DNSProvider string
+	CAServer    string
 }
 
 // AppConfig represents the app section of the config.yml
@@ -50,11 +59,15 @@ type AppConfig struct {
 		DashboardURL string `yaml:"dashboard_url"`
 		LogLevel     string `yaml:"log_level"`
 	} `yaml:"app"`
+	Domains map[string]struct {
+		BaseDomain string `yaml:"base_domain"`
+	} `yaml:"domains"`
 }
 
 type AppConfigValues struct {
 	DashboardURL string
 	LogLevel     string
+	BaseDomain   string
 }
 
 // ReadTraefikConfig reads and extracts values from Traefik configuration files
@@ -74,6 +87,18 @@ func ReadTraefikConfig(mainConfigPath string) (*TraefikConfigValues, error) {
 	values := &TraefikConfigValues{
 		BadgerVersion:    mainConfig.Experimental.Plugins.Badger.Version,
 		LetsEncryptEmail: mainConfig.CertificatesResolvers.LetsEncrypt.Acme.Email,
+		DNSProvider:      mainConfig.CertificatesResolvers.LetsEncrypt.Acme.DNSChallenge.Provider,
+		CAServer:         mainConfig.CertificatesResolvers.LetsEncrypt.Acme.CAServer,
+	}
+
+	if values.LetsEncryptEmail == "" {
+		return nil, fmt.Errorf("%s has no certificatesResolvers.letsencrypt.acme.email", mainConfigPath)
+	}
+	if ok, reason := validateEmail(values.LetsEncryptEmail); !ok {
+		return nil, fmt.Errorf("invalid Let's Encrypt email %q in %s: %s", values.LetsEncryptEmail, mainConfigPath, reason)
+	}
+	if values.BadgerVersion == "" {
+		return nil, fmt.Errorf("%s has no experimental.plugins.badger.version", mainConfigPath)
 	}
 
 	return values, nil
@@ -96,9 +121,196 @@ func ReadAppConfig(configPath string) (*AppConfigValues, error) {
 		LogLevel:     appConfig.App.LogLevel,
 	}
 
+	// The installer writes the base domain as domain1
+	if domain, ok := appConfig.Domains["domain1"]; ok {
+		values.BaseDomain = domain.BaseDomain
+	}
+
 	return values, nil
 }
 
+// Secrets can be passed in the environment so they are neither typed in nor stored in an
+// answer file. A set variable wins over the answer file, which wins over the prompt.
+const (
+	smtpPassEnv     = "PANGOLIN_SMTP_PASS"
+	secretEnv       = "PANGOLIN_SECRET"
+	postgresPassEnv = "PANGOLIN_POSTGRES_PASS"
+)
+
+// printConfig prints the effective configuration as YAML, including the values answer
+// files leave out, with every secret masked
+func printConfig(config Config) error {
+	config.EmailSMTPPass = maskSecret(config.EmailSMTPPass)
+	config.DNSAPIToken = maskSecret(config.DNSAPIToken)
+	config.PostgresPass = maskSecret(config.PostgresPass)
+
+	effective := struct {
+		Config          `yaml:",inline"`
+		Secret          string `yaml:"secret"`
+		PangolinVersion string `yaml:"pangolin_version"`
+		GerbilVersion   string `yaml:"gerbil_version"`
+		BadgerVersion   string `yaml:"badger_version"`
+	}{
+		Config:          config,
+		Secret:          maskSecret(config.Secret),
+		PangolinVersion: config.PangolinVersion,
+		GerbilVersion:   config.GerbilVersion,
+		BadgerVersion:   config.BadgerVersion,
+	}
+
+	data, err := yaml.Marshal(&effective)
+	if err != nil {
+		return fmt.Errorf("error marshaling the configuration: %w", err)
+	}
+	fmt.Print(string(data))
+	return nil
+}
+
+// exportCompose renders only the compose file of config and writes it to output, or to stdout
+// when output is empty. Nothing else is written and the containers are not touched.
+func exportCompose(config Config, output string) error {
+	dir, err := os.MkdirTemp("", "pangolin-export-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := renderConfigFiles(config, dir); err != nil {
+		return err
+	}
+	composeFile := filepath.Join(dir, "config/docker-compose.yml")
+	if *swarmFlag {
+		if err := convertComposeForSwarm(composeFile); err != nil {
+			return err
+		}
+	}
+	data, err := os.ReadFile(composeFile)
+	if err != nil {
+		return fmt.Errorf("failed to read the rendered compose file: %v", err)
+	}
+
+	if output == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+	logInfo("Compose file written to %s", output)
+	return nil
+}
+
+// loadAnswerFile reads installer answers from a YAML file. Missing fields fall back to the
+// same defaults collectUserInput uses, and every missing required field is reported at once.
+func loadAnswerFile(path string) (Config, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading answer file: %w", err)
+	}
+	defer file.Close()
+
+	config := defaultConfig()
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&config); err != nil && err != io.EOF {
+		return Config{}, fmt.Errorf("error parsing answer file: %w", err)
+	}
+
+	if pass, ok := os.LookupEnv(smtpPassEnv); ok {
+		config.EmailSMTPPass = pass
+	}
+	if pass, ok := os.LookupEnv(postgresPassEnv); ok {
+		config.PostgresPass = pass
+	}
+
+	if config.DashboardDomain == "" && config.BaseDomain != "" {
+		config.DashboardDomain = "pangolin." + config.BaseDomain
+	}
+
+	var missing []string
+	if config.BaseDomain == "" {
+		missing = append(missing, "base_domain")
+	}
+	if config.DashboardDomain == "" {
+		missing = append(missing, "dashboard_domain")
+	}
+	if config.LetsEncryptEmail == "" {
+		missing = append(missing, "lets_encrypt_email")
+	}
+	if len(missing) > 0 {
+		return Config{}, fmt.Errorf("answer file %s is missing required fields: %s", path, strings.Join(missing, ", "))
+	}
+
+	for field, domain := range map[string]string{"base_domain": config.BaseDomain, "dashboard_domain": config.DashboardDomain} {
+		if ok, reason := validateDomain(domain); !ok {
+			return Config{}, fmt.Errorf("invalid %s in answer file: %s", field, reason)
+		}
+	}
+	if ok, reason := validateEmail(config.LetsEncryptEmail); !ok {
+		return Config{}, fmt.Errorf("invalid lets_encrypt_email in answer file: %s", reason)
+	}
+	if config.EnableEmail && (config.EmailSMTPPort < 1 || config.EmailSMTPPort > 65535) {
+		return Config{}, fmt.Errorf("invalid email_smtp_port in answer file: %d is not between 1 and 65535", config.EmailSMTPPort)
+	}
+	if config.EnableEmail && config.EmailNoReply != "" {
+		if ok, reason := validateEmail(config.EmailNoReply); !ok {
+			return Config{}, fmt.Errorf("invalid email_no_reply in answer file: %s", reason)
+		}
+	}
+
+	return config, nil
+}
+
+// writeAnswerFile saves the answers of config as a YAML file that loadAnswerFile can read back.
+// The SMTP password is left out unless includeSecrets is set.
+func writeAnswerFile(config Config, path string, includeSecrets bool) error {
+	var node yaml.Node
+	if err := node.Encode(&config); err != nil {
+		return fmt.Errorf("error marshaling answers: %w", err)
+	}
+
+	// Mapping nodes hold alternating key and value nodes
+	if !includeSecrets {
+		for i := 0; i+1 < len(node.Content); {
+			if key := node.Content[i].Value; key == "email_smtp_pass" || key == "dns_api_token" || key == "postgres_pass" {
+				node.Content = append(node.Content[:i], node.Content[i+2:]...)
+				continue
+			}
+			i += 2
+		}
+	}
+
+	data, err := yaml.Marshal(&node)
+	if err != nil {
+		return fmt.Errorf("error marshaling answers: %w", err)
+	}
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("error writing answer file: %w", err)
+	}
+	return nil
+}
+
+// readComposeServices returns the services section of a Docker Compose file
+func readComposeServices(composePath string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var compose map[string]interface{}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, fmt.Errorf("error parsing compose file: %w", err)
+	}
+
+	services, ok := compose["services"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("services section not found or invalid in %s", composePath)
+	}
+
+	return services, nil
+}
+
 // findPattern finds the start of a pattern in a string
 func findPattern(s, pattern string) int {
 	return bytes.Index([]byte(s), []byte(pattern))
@@ -201,25 +413,6 @@ func MarshalYAMLWithIndent(data interface{}, indent int) ([]byte, error) {
 	return buffer.Bytes(), nil
 }
 
-func replaceInFile(filepath, oldStr, newStr string) error {
-	// Read the file content
-	content, err := os.ReadFile(filepath)
-	if err != nil {
-		return fmt.Errorf("error reading file: %v", err)
-	}
-
-	// Replace the string
-	newContent := strings.Replace(string(content), oldStr, newStr, -1)
-
-	// Write the modified content back to the file
-	err = os.WriteFile(filepath, []byte(newContent), 0644)
-	if err != nil {
-		return fmt.Errorf("error writing file: %v", err)
-	}
-
-	return nil
-}
-
 func CheckAndAddTraefikLogVolume(composePath string) error {
 	// Read the docker-compose.yml file
 	data, err := os.ReadFile(composePath)
@@ -253,7 +446,7 @@ func CheckAndAddTraefikLogVolume(composePath string) error {
 		// Check if volume already exists
 		for _, v := range existingVolumes {
 			if v.(string) == logVolume {
-				fmt.Println("Traefik log volume is already configured")
+				logInfo("Traefik log volume is already configured")
 				return nil
 			}
 		}
@@ -274,7 +467,7 @@ func CheckAndAddTraefikLogVolume(composePath string) error {
 		return fmt.Errorf("error writing updated compose file: %w", err)
 	}
 
-	fmt.Println("Added traefik log volume and created logs directory")
+	logInfo("Added traefik log volume and created logs directory")
 	return nil
 }
 
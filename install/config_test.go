@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadAnswerFileSecretsFromEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "answers.yml")
+	answers := `base_domain: example.com
+lets_encrypt_email: admin@company.io
+enable_email: true
+email_smtp_host: smtp.company.io
+email_smtp_pass: from-file
+`
+	if err := os.WriteFile(path, []byte(answers), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadAnswerFile(path)
+	if err != nil {
+		t.Fatalf("loadAnswerFile: %v", err)
+	}
+	if config.EmailSMTPPass != "from-file" {
+		t.Errorf("without %s the SMTP password = %q, want the answer file value", smtpPassEnv, config.EmailSMTPPass)
+	}
+
+	t.Setenv(smtpPassEnv, "from-env")
+	config, err = loadAnswerFile(path)
+	if err != nil {
+		t.Fatalf("loadAnswerFile: %v", err)
+	}
+	if config.EmailSMTPPass != "from-env" {
+		t.Errorf("with %s set the SMTP password = %q, want the environment value over the answer file", smtpPassEnv, config.EmailSMTPPass)
+	}
+}
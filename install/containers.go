@@ -1,102 +1,237 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"os/user"
+	"path/filepath"
 	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func waitForContainer(containerName string, containerType SupportedContainer) error {
-	maxAttempts := 30
-	retryInterval := time.Second * 2
+// waitClock is the time source of the container waits, a fake one lets tests reach the
+// deadline without sleeping
+type waitClock struct {
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// systemClock is the real time
+var systemClock = waitClock{now: time.Now, sleep: time.Sleep}
+
+// pollUntil calls ready every interval until it returns true or timeout has passed on clock,
+// and reports whether it returned true in time
+func pollUntil(timeout time.Duration, interval time.Duration, clock waitClock, ready func() bool) bool {
+	for deadline := clock.now().Add(timeout); clock.now().Before(deadline); {
+		if ready() {
+			return true
+		}
+		clock.sleep(interval)
+	}
+	return false
+}
+
+func waitForContainer(containerName string, containerType SupportedContainer, timeout time.Duration, retryInterval time.Duration) error {
+	running := pollUntil(timeout, retryInterval, systemClock, func() bool {
+		if *swarmFlag && containerType == Docker {
+			return isSwarmServiceRunning(containerName)
+		}
 
-	for attempt := 0; attempt < maxAttempts; attempt++ {
 		// Check if container is running
 		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}}", containerName)
 		var out bytes.Buffer
 		cmd.Stdout = &out
 
+		// If the container doesn't exist or there's another error, wait and retry
 		if err := cmd.Run(); err != nil {
-			// If the container doesn't exist or there's another error, wait and retry
-			time.Sleep(retryInterval)
-			continue
+			return false
 		}
+		return strings.TrimSpace(out.String()) == "true"
+	})
+	if !running {
+		return fmt.Errorf("container %s did not start within %s", containerName, timeout)
+	}
+	return nil
+}
 
-		isRunning := strings.TrimSpace(out.String()) == "true"
-		if isRunning {
-			return nil
+// waitForContainerHealthy waits until the healthcheck of the container reports healthy.
+// Containers without a healthcheck only need to be running.
+func waitForContainerHealthy(containerName string, containerType SupportedContainer, timeout time.Duration, retryInterval time.Duration) error {
+	healthy := pollUntil(timeout, retryInterval, systemClock, func() bool {
+		if *swarmFlag && containerType == Docker {
+			return isSwarmServiceRunning(containerName)
 		}
 
-		// Container exists but isn't running yet, wait and retry
-		time.Sleep(retryInterval)
+		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}} {{if .State.Health}}{{.State.Health.Status}}{{end}}", containerName)
+		var out bytes.Buffer
+		cmd.Stdout = &out
+
+		// If the container doesn't exist or there's another error, wait and retry
+		if err := cmd.Run(); err != nil {
+			return false
+		}
+
+		// Still starting or not yet passing its healthcheck until both are true
+		running, health, _ := strings.Cut(strings.TrimSpace(out.String()), " ")
+		return running == "true" && (health == "" || health == "healthy")
+	})
+	if !healthy {
+		return fmt.Errorf("container %s did not become healthy within %s", containerName, timeout)
+	}
+	return nil
+}
+
+// waitPatiently runs wait with --container-wait-timeout, checking every --healthcheck-interval.
+// When it times out on a terminal, the recent logs of the container are shown and the user can
+// keep waiting another --container-wait-extend.
+func waitPatiently(containerName string, containerType SupportedContainer, wait func(string, SupportedContainer, time.Duration, time.Duration) error) error {
+	err := wait(containerName, containerType, *containerWaitTimeoutFlag, *healthcheckIntervalFlag)
+	if err == nil || *quietFlag || !isStdinTerminal() {
+		return err
+	}
+
+	reader := stdinReader
+	for err != nil {
+		logWarn("Warning: %v", err)
+		if logs, logErr := recentContainerLogs(containerName, containerType, 20); logErr != nil {
+			logWarn("Warning: could not read the logs of %s: %v", containerName, logErr)
+		} else {
+			logInfo("Last log lines of %s:\n%s", containerName, logs)
+		}
+
+		if !readBool(reader, fmt.Sprintf("Keep waiting another %s for %s?", *containerWaitExtendFlag, containerName), true) {
+			return err
+		}
+		err = wait(containerName, containerType, *containerWaitExtendFlag, *healthcheckIntervalFlag)
+	}
+	return nil
+}
+
+// recentContainerLogs returns the last lines the container wrote to stdout and stderr
+func recentContainerLogs(containerName string, containerType SupportedContainer, lines int) (string, error) {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if *swarmFlag && containerType == Docker {
+		cmd = newCommand(ctx, "docker", "service", "logs", "--raw", "--tail", strconv.Itoa(lines), swarmServiceName(containerName))
+	} else {
+		cmd = newCommand(ctx, string(containerType), "logs", "--tail", strconv.Itoa(lines), containerName)
+	}
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := runCommandContext(ctx, cmd); err != nil {
+		return "", err
+	}
+	return strings.TrimRight(out.String(), "\n"), nil
+}
+
+// isStackRunning reports whether the pangolin container is running under either container runtime.
+func isStackRunning() bool {
+	for _, containerType := range []SupportedContainer{Docker, Podman} {
+		cmd := exec.Command(string(containerType), "container", "inspect", "-f", "{{.State.Running}}", "pangolin")
+		var out bytes.Buffer
+		cmd.Stdout = &out
+		if err := cmd.Run(); err == nil && strings.TrimSpace(out.String()) == "true" {
+			return true
+		}
 	}
+	return false
+}
 
-	return fmt.Errorf("container %s did not start within %v seconds", containerName, maxAttempts*int(retryInterval.Seconds()))
+// parseOSRelease parses the KEY=value lines of /etc/os-release, removing the optional quotes
+func parseOSRelease(data string) map[string]string {
+	release := make(map[string]string)
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, "'\"")
+		}
+		release[key] = value
+	}
+	return release
 }
 
 func installDocker() error {
 	// Detect Linux distribution
-	cmd := exec.Command("cat", "/etc/os-release")
-	output, err := cmd.Output()
+	output, err := os.ReadFile("/etc/os-release")
 	if err != nil {
 		return fmt.Errorf("failed to detect Linux distribution: %v", err)
 	}
-	osRelease := string(output)
+	osRelease := parseOSRelease(string(output))
 
-	// Detect system architecture
-	archCmd := exec.Command("uname", "-m")
-	archOutput, err := archCmd.Output()
+	if *assumeDistroFlag != "" {
+		logWarn("Warning: ignoring /etc/os-release and installing Docker as on %s (--assume-distro).", *assumeDistroFlag)
+		osRelease = map[string]string{"ID": *assumeDistroFlag}
+	}
+	distroID, err := resolveDistro(osRelease)
 	if err != nil {
-		return fmt.Errorf("failed to detect system architecture: %v", err)
+		return err
 	}
-	arch := strings.TrimSpace(string(archOutput))
 
-	// Map architecture to Docker's architecture naming
-	var dockerArch string
-	switch arch {
-	case "x86_64":
-		dockerArch = "amd64"
-	case "aarch64":
-		dockerArch = "arm64"
-	default:
-		return fmt.Errorf("unsupported architecture: %s", arch)
+	if err := waitForPackageManager(distroID); err != nil {
+		return err
 	}
 
+	dockerArch, err := detectArch()
+	if err != nil {
+		return fmt.Errorf("%v. Please install Docker manually, see https://docs.docker.com/engine/install/", err)
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
 	var installCmd *exec.Cmd
 	switch {
-	case strings.Contains(osRelease, "ID=ubuntu"):
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+	case distroID == "ubuntu":
+		installCmd = newCommand(ctx, "bash", "-c", fmt.Sprintf(`
 			apt-get update &&
 			apt-get install -y apt-transport-https ca-certificates curl software-properties-common &&
-			curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
-			echo "deb [arch=%s signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(lsb_release -cs) stable" > /etc/apt/sources.list.d/docker.list &&
+			curl -fsSL https://download.docker.com/linux/ubuntu/gpg | gpg --batch --yes --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
+			echo "deb [arch=%s signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/ubuntu $(. /etc/os-release && echo ${UBUNTU_CODENAME:-$(lsb_release -cs)}) stable" > /etc/apt/sources.list.d/docker.list &&
 			apt-get update &&
 			apt-get install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin
 		`, dockerArch))
-	case strings.Contains(osRelease, "ID=debian"):
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+	case distroID == "debian" || distroID == "raspbian":
+		// 32-bit Raspberry Pi OS reports ID=raspbian and has its own repository
+		repo := "debian"
+		if distroID == "raspbian" {
+			repo = "raspbian"
+		}
+		installCmd = newCommand(ctx, "bash", "-c", fmt.Sprintf(`
 			apt-get update &&
 			apt-get install -y apt-transport-https ca-certificates curl software-properties-common &&
-			curl -fsSL https://download.docker.com/linux/debian/gpg | gpg --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
-			echo "deb [arch=%s signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/debian $(lsb_release -cs) stable" > /etc/apt/sources.list.d/docker.list &&
+			curl -fsSL https://download.docker.com/linux/%[2]s/gpg | gpg --batch --yes --dearmor -o /usr/share/keyrings/docker-archive-keyring.gpg &&
+			echo "deb [arch=%[1]s signed-by=/usr/share/keyrings/docker-archive-keyring.gpg] https://download.docker.com/linux/%[2]s $(lsb_release -cs) stable" > /etc/apt/sources.list.d/docker.list &&
 			apt-get update &&
 			apt-get install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin
-		`, dockerArch))
-	case strings.Contains(osRelease, "ID=fedora"):
+		`, dockerArch, repo))
+	case distroID == "fedora":
 		// Detect Fedora version to handle DNF 5 changes
-		versionCmd := exec.Command("bash", "-c", "grep VERSION_ID /etc/os-release | cut -d'=' -f2 | tr -d '\"'")
-		versionOutput, err := versionCmd.Output()
-		var fedoraVersion int
-		if err == nil {
-			if v, parseErr := strconv.Atoi(strings.TrimSpace(string(versionOutput))); parseErr == nil {
-				fedoraVersion = v
-			}
+		fedoraVersion, err := strconv.Atoi(osRelease["VERSION_ID"])
+		if err != nil {
+			// Current releases ship DNF 5, so that is the safer guess
+			logWarn("Warning: could not determine the Fedora version, assuming DNF 5.")
+			fedoraVersion = 41
 		}
 
 		// Use appropriate DNF syntax based on version
@@ -109,60 +244,188 @@ func installDocker() error {
 			repoCmd = "dnf config-manager --add-repo https://download.docker.com/linux/fedora/docker-ce.repo"
 		}
 
-		installCmd = exec.Command("bash", "-c", fmt.Sprintf(`
+		installCmd = newCommand(ctx, "bash", "-c", fmt.Sprintf(`
 			dnf -y install dnf-plugins-core &&
 			%s &&
 			dnf install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin
 		`, repoCmd))
-	case strings.Contains(osRelease, "ID=opensuse") || strings.Contains(osRelease, "ID=\"opensuse-"):
-		installCmd = exec.Command("bash", "-c", `
+	case strings.HasPrefix(distroID, "opensuse"):
+		installCmd = newCommand(ctx, "bash", "-c", `
 			zypper install -y docker docker-compose &&
 			systemctl enable docker
 		`)
-	case strings.Contains(osRelease, "ID=rhel") || strings.Contains(osRelease, "ID=\"rhel"):
-		installCmd = exec.Command("bash", "-c", `
+	case distroID == "rhel":
+		installCmd = newCommand(ctx, "bash", "-c", `
 			dnf remove -y runc &&
 			dnf -y install yum-utils &&
 			dnf config-manager --add-repo https://download.docker.com/linux/rhel/docker-ce.repo &&
 			dnf install -y docker-ce docker-ce-cli containerd.io docker-compose-plugin &&
 			systemctl enable docker
 		`)
-	case strings.Contains(osRelease, "ID=amzn"):
-		installCmd = exec.Command("bash", "-c", `
+	case distroID == "amzn":
+		installCmd = newCommand(ctx, "bash", "-c", `
 			yum update -y &&
 			yum install -y docker &&
 			systemctl enable docker &&
 			usermod -a -G docker ec2-user
 		`)
+	case distroID == "alpine":
+		// Alpine ships without bash and uses OpenRC instead of systemd
+		installCmd = newCommand(ctx, "sh", "-c", `
+			apk add docker docker-cli-compose &&
+			rc-update add docker default
+		`)
+	case distroID == "arch":
+		installCmd = newCommand(ctx, "bash", "-c", `
+			pacman -Sy --noconfirm docker docker-compose &&
+			systemctl enable docker
+		`)
 	default:
 		return fmt.Errorf("unsupported Linux distribution")
 	}
 
-	installCmd.Stdout = os.Stdout
-	installCmd.Stderr = os.Stderr
-	return installCmd.Run()
+	installCmd.Stdout, installCmd.Stderr = commandOutput()
+	return runCommandContext(ctx, installCmd)
+}
+
+// isSupportedDistro reports whether installDocker has an install path for the os-release ID
+func isSupportedDistro(id string) bool {
+	switch id {
+	case "ubuntu", "debian", "raspbian", "fedora", "rhel", "amzn", "alpine", "arch":
+		return true
+	}
+	return strings.HasPrefix(id, "opensuse")
+}
+
+// resolveDistro returns the distribution whose install path installDocker uses. Derivatives
+// like Linux Mint or Rocky Linux fall back to the first supported entry of their ID_LIKE,
+// and on a terminal the user can pick a base distribution when nothing matches.
+func resolveDistro(osRelease map[string]string) (string, error) {
+	id := osRelease["ID"]
+	if isSupportedDistro(id) {
+		return id, nil
+	}
+
+	for _, like := range strings.Fields(osRelease["ID_LIKE"]) {
+		if isSupportedDistro(like) {
+			logInfo("%s is not directly supported, installing Docker as on %s (ID_LIKE).", id, like)
+			return like, nil
+		}
+	}
+
+	if *quietFlag || !isStdinTerminal() {
+		return "", fmt.Errorf("unsupported Linux distribution %q, pass --assume-distro with a compatible base distribution (%s)", id, strings.Join(assumableDistros, ", "))
+	}
+	logWarn("Warning: %q is not a supported Linux distribution.", id)
+	choice := readValidatedString(stdinReader, "Enter the base distribution it is compatible with ("+strings.Join(assumableDistros, ", ")+")", "", func(value string) (bool, string) {
+		if !slices.Contains(assumableDistros, value) {
+			return false, "must be one of " + strings.Join(assumableDistros, ", ")
+		}
+		return true, ""
+	})
+	return choice, nil
+}
+
+// waitForPackageManager waits up to --package-lock-timeout for a running package manager, e.g.
+// unattended-upgrades on a freshly booted cloud instance, to release its lock
+func waitForPackageManager(distroID string) error {
+	busy := packageManagerBusy(distroID)
+	if busy == "" {
+		return nil
+	}
+
+	logInfo("Waiting for the package manager: %s...", busy)
+	deadline := time.Now().Add(*packageLockTimeoutFlag)
+	for time.Now().Before(deadline) {
+		time.Sleep(5 * time.Second)
+		if busy = packageManagerBusy(distroID); busy == "" {
+			logInfo("The package manager is available.")
+			return nil
+		}
+		logInfo("Still waiting, %s left: %s", time.Until(deadline).Round(time.Second), busy)
+	}
+	return fmt.Errorf("the package manager is still busy after %s (%s), wait for the background updates to finish or raise --package-lock-timeout", *packageLockTimeoutFlag, busy)
+}
+
+// detectInitSystem returns "systemd", "openrc", "sysvinit" or "" if none could be found
+func detectInitSystem() string {
+	if _, err := os.Stat("/run/systemd/system"); err == nil {
+		return "systemd"
+	}
+	if _, err := os.Stat("/sbin/openrc"); err == nil {
+		return "openrc"
+	}
+	if _, err := exec.LookPath("service"); err == nil {
+		return "sysvinit"
+	}
+	return ""
 }
 
 func startDockerService() error {
 	if runtime.GOOS == "linux" {
-		cmd := exec.Command("systemctl", "enable", "--now", "docker")
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		return cmd.Run()
+		initSystem := detectInitSystem()
+
+		ctx, cancel := commandContext()
+		defer cancel()
+
+		var cmd *exec.Cmd
+		switch initSystem {
+		case "systemd":
+			cmd = newCommand(ctx, "systemctl", "enable", "--now", "docker")
+		case "openrc":
+			cmd = newCommand(ctx, "sh", "-c", "rc-service docker start && rc-update add docker")
+		case "sysvinit":
+			cmd = newCommand(ctx, "service", "docker", "start")
+		default:
+			return fmt.Errorf("could not detect the init system (no systemd, OpenRC or service command), please start Docker manually")
+		}
+		cmd.Stdout, cmd.Stderr = commandOutput()
+		if err := runCommandContext(ctx, cmd); err != nil {
+			return fmt.Errorf("failed to start Docker with %s: %v", initSystem, err)
+		}
+		return nil
 	} else if runtime.GOOS == "darwin" {
 		// On macOS, Docker is usually started via the Docker Desktop application
-		fmt.Println("Please start Docker Desktop manually on macOS.")
+		logInfo("Please start Docker Desktop manually on macOS.")
 		return nil
 	}
 	return fmt.Errorf("unsupported operating system for starting Docker service")
 }
 
+// detectContainerType picks the installed container runtime, preferring Docker unless
+// --runtime forces one.
+func detectContainerType() SupportedContainer {
+	switch *runtimeFlag {
+	case "docker":
+		if isDockerInstalled() {
+			return Docker
+		}
+		return Undefined
+	case "podman":
+		if isPodmanInstalled() {
+			return Podman
+		}
+		return Undefined
+	}
+
+	if isDockerInstalled() {
+		return Docker
+	}
+	if isPodmanInstalled() {
+		return Podman
+	}
+	return Undefined
+}
+
 func isDockerInstalled() bool {
 	return isContainerInstalled("docker")
 }
 
 func isPodmanInstalled() bool {
-	return isContainerInstalled("podman") && isContainerInstalled("podman-compose")
+	if !isContainerInstalled("podman") {
+		return false
+	}
+	return isContainerInstalled("podman-compose") || exec.Command("podman", "compose", "version").Run() == nil
 }
 
 func isContainerInstalled(container string) bool {
@@ -201,6 +464,28 @@ func isUserInDockerGroup() bool {
 	return false
 }
 
+// startDockerAndWait starts the Docker service and polls for up to 10 seconds until the
+// daemon answers. Errors starting the service are reported but the daemon is still polled.
+func startDockerAndWait() bool {
+	// try to start docker service but ignore errors
+	if err := startDockerService(); err != nil {
+		logError("Error starting Docker service: %v", err)
+	} else {
+		logInfo("Docker service started successfully!")
+	}
+	// wait 10 seconds for docker to start checking if docker is running every 2 seconds
+	logInfo("Waiting for Docker to start...")
+	for i := 0; i < 5; i++ {
+		if isDockerRunning() {
+			logInfo("Docker is running!")
+			return true
+		}
+		logInfo("Docker is not running yet, waiting...")
+		time.Sleep(2 * time.Second)
+	}
+	return isDockerRunning()
+}
+
 // isDockerRunning checks if the Docker daemon is running by using the `docker info` command.
 func isDockerRunning() bool {
 	cmd := exec.Command("docker", "info")
@@ -210,13 +495,84 @@ func isDockerRunning() bool {
 	return true
 }
 
-// executeDockerComposeCommandWithArgs executes the appropriate docker command with arguments supplied
-func executeDockerComposeCommandWithArgs(args ...string) error {
+// rootlessDockerSockets returns the sockets of the rootless Docker daemons on this host, which
+// live in the runtime directory of the user running them
+func rootlessDockerSockets() []string {
+	candidates, _ := filepath.Glob("/run/user/*/docker.sock")
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		candidates = append(candidates, filepath.Join(dir, "docker.sock"))
+	}
+	if socket, ok := strings.CutPrefix(os.Getenv("DOCKER_HOST"), "unix://"); ok && socket != "/var/run/docker.sock" && socket != "/run/docker.sock" {
+		candidates = append(candidates, socket)
+	}
+
+	var sockets []string
+	for _, socket := range candidates {
+		if info, err := os.Stat(socket); err == nil && info.Mode()&os.ModeSocket != 0 && !slices.Contains(sockets, socket) {
+			sockets = append(sockets, socket)
+		}
+	}
+	return sockets
+}
+
+// socketOwner returns the name of the user owning a socket, or its uid when the user is unknown
+func socketOwner(socket string) string {
+	info, err := os.Stat(socket)
+	if err != nil {
+		return "its owner"
+	}
+	uid, _, ok := fileOwner(info)
+	if !ok {
+		return "its owner"
+	}
+	if owner, err := user.LookupId(strconv.Itoa(uid)); err == nil {
+		return owner.Username
+	}
+	return "uid " + strconv.Itoa(uid)
+}
+
+// warnRootlessDocker explains why Docker looks stopped when the installer runs as root while
+// the daemon on this host is rootless: root talks to the system daemon and never sees the
+// daemon of the user. It reports whether it found such a daemon.
+func warnRootlessDocker() bool {
+	if os.Geteuid() != 0 || runtime.GOOS != "linux" {
+		return false
+	}
+	sockets := rootlessDockerSockets()
+	if len(sockets) == 0 {
+		return false
+	}
+
+	for _, socket := range sockets {
+		owner := socketOwner(socket)
+		logWarn("Warning: found a rootless Docker daemon of %s at %s, which the installer cannot reach running as root.", owner, socket)
+		logWarn("Run the installer as %s without sudo, or point it at that daemon with DOCKER_HOST=unix://%s.", owner, socket)
+	}
+	return true
+}
+
+// warnRootDockerRootless warns when the installer runs as root against a rootless daemon, e.g.
+// through DOCKER_HOST. The containers then run as the daemon's user while config/ belongs to root.
+func warnRootDockerRootless() {
+	if os.Geteuid() != 0 || runtime.GOOS != "linux" {
+		return
+	}
+	out, err := exec.Command("docker", "info", "--format", "{{json .SecurityOptions}}").Output()
+	if err != nil || !strings.Contains(string(out), "rootless") {
+		return
+	}
+	logWarn("Warning: the Docker daemon is rootless but the installer runs as root, so the files in config/ will belong to root.")
+	logWarn("Run the installer as the user owning the daemon, or fix the ownership afterwards with --repair-permissions.")
+}
+
+// dockerComposeCommand builds a compose command for whichever of "docker compose" and
+// "docker-compose" is available
+func dockerComposeCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
 	var cmd *exec.Cmd
 	var useNewStyle bool
 
 	if !isDockerInstalled() {
-		return fmt.Errorf("docker is not installed")
+		return nil, fmt.Errorf("docker is not installed")
 	}
 
 	checkCmd := exec.Command("docker", "compose", "version")
@@ -227,106 +583,403 @@ func executeDockerComposeCommandWithArgs(args ...string) error {
 		if err := checkCmd.Run(); err == nil {
 			useNewStyle = false
 		} else {
-			return fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
+			return nil, fmt.Errorf("neither 'docker compose' nor 'docker-compose' command is available")
 		}
 	}
 
 	if useNewStyle {
-		cmd = exec.Command("docker", append([]string{"compose"}, args...)...)
+		cmd = newCommand(ctx, "docker", append([]string{"compose"}, args...)...)
 	} else {
-		cmd = exec.Command("docker-compose", args...)
+		cmd = newCommand(ctx, "docker-compose", args...)
 	}
 
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return cmd, nil
 }
 
-// pullContainers pulls the containers using the appropriate command.
+// podmanComposeCommand builds a compose command for podman-compose, or "podman compose" if
+// podman-compose is not installed
+func podmanComposeCommand(ctx context.Context, args ...string) (*exec.Cmd, error) {
+	if isContainerInstalled("podman-compose") {
+		return newCommand(ctx, "podman-compose", args...), nil
+	}
+	if exec.Command("podman", "compose", "version").Run() == nil {
+		return newCommand(ctx, "podman", append([]string{"compose"}, args...)...), nil
+	}
+	return nil, fmt.Errorf("neither 'podman-compose' nor 'podman compose' command is available")
+}
+
+// composeCommand builds a compose command for the given container runtime, bound to ctx
+func composeCommand(ctx context.Context, containerType SupportedContainer, args ...string) (*exec.Cmd, error) {
+	switch containerType {
+	case Docker:
+		return dockerComposeCommand(ctx, args...)
+	case Podman:
+		return podmanComposeCommand(ctx, args...)
+	default:
+		return nil, fmt.Errorf("Unsupported container type: %s", containerType)
+	}
+}
+
+// executeContainerCommandWithArgs runs a compose command with the given container runtime
+func executeContainerCommandWithArgs(containerType SupportedContainer, args ...string) error {
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	cmd, err := composeCommand(ctx, containerType, args...)
+	if err != nil {
+		return err
+	}
+
+	cmd.Stdout, cmd.Stderr = commandOutput()
+	return runCommandContext(ctx, cmd)
+}
+
+// pullContainers pulls the containers using the appropriate command, retrying
+// network errors with exponential backoff up to --pull-retries times.
 func pullContainers(containerType SupportedContainer) error {
-	fmt.Println("Pulling the container images...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "pull"); err != nil {
+	logInfo("Pulling the container images...")
+	warnDockerDaemonProxy(containerType)
+
+	delay := 5 * time.Second
+	for attempt := 0; ; attempt++ {
+		output, err := pullContainersOnce(containerType)
+		if err == nil && *writeImageLockFlag != "" {
+			return writeImageLock(*writeImageLockFlag, containerType)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= *pullRetriesFlag || !isRetryablePullError(output) {
 			return fmt.Errorf("failed to pull the containers: %v", err)
 		}
 
-		return nil
+		logInfo("Pulling failed, retrying in %s (retry %d of %d)...", delay, attempt+1, *pullRetriesFlag)
+		time.Sleep(delay)
+		delay *= 3
 	}
+}
 
+// pullContainersOnce runs a single pull and returns its error output alongside the error
+func pullContainersOnce(containerType SupportedContainer) (string, error) {
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return "", err
+	}
+
+	args := append(composeFileArgs(composeFile), "pull")
 	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "pull", "--policy", "always"); err != nil {
-			return fmt.Errorf("failed to pull the containers: %v", err)
+		args = append(args, "--policy", "always")
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	cmd, err := composeCommand(ctx, containerType, args...)
+	if err != nil {
+		return "", err
+	}
+
+	var stderr bytes.Buffer
+	stdoutWriter, stderrWriter := commandOutput()
+	cmd.Stdout = stdoutWriter
+	cmd.Stderr = io.MultiWriter(stderrWriter, &stderr)
+	err = runCommandContext(ctx, cmd)
+	return stderr.String(), err
+}
+
+// isRetryablePullError reports whether the pull output looks like a transient network
+// or registry problem. Authentication and missing image errors are not retried.
+func isRetryablePullError(output string) bool {
+	output = strings.ToLower(output)
+
+	for _, permanent := range []string{"unauthorized", "authentication required", "denied", "manifest unknown", "not found"} {
+		if strings.Contains(output, permanent) {
+			return false
+		}
+	}
+
+	for _, transient := range []string{"timeout", "timed out", "connection reset", "connection refused", "no such host",
+		"temporary failure", "tls handshake", "unexpected eof", "toomanyrequests", "too many requests", "rate limit",
+		"502 bad gateway", "503 service unavailable", "504 gateway", "network is unreachable"} {
+		if strings.Contains(output, transient) {
+			return true
 		}
+	}
+	return false
+}
+
+// composeFilePath returns the compose file given by --compose-file, failing with
+// its path when it does not exist
+func composeFilePath() (string, error) {
+	if _, err := os.Stat(*composeFileFlag); err != nil {
+		return "", fmt.Errorf("compose file %s not found, run this from the installation directory or pass --compose-file", *composeFileFlag)
+	}
+	return *composeFileFlag, nil
+}
+
+// detectArch returns the architecture of this machine in Docker's naming (amd64, arm64 or armhf)
+func detectArch() (string, error) {
+	archOutput, err := exec.Command("uname", "-m").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to detect system architecture: %v", err)
+	}
+	arch := strings.TrimSpace(string(archOutput))
+
+	switch arch {
+	case "x86_64":
+		return "amd64", nil
+	case "aarch64":
+		return "arm64", nil
+	case "armv7l", "armhf":
+		// 32-bit ARM, e.g. Raspberry Pi OS; Docker publishes these packages as armhf
+		return "armhf", nil
+	default:
+		return "", fmt.Errorf("unsupported architecture: %s", arch)
+	}
+}
+
+// composeOverrideFile is the user-owned compose file that is merged over the generated one.
+// The installer never writes it.
+const composeOverrideFile = "docker-compose.override.yml"
 
+// composeOverridePath returns the override file next to composeFile, or "" if there is none
+func composeOverridePath(composeFile string) string {
+	override := filepath.Join(filepath.Dir(composeFile), composeOverrideFile)
+	if _, err := os.Stat(override); err != nil {
+		return ""
+	}
+	return override
+}
+
+// composeFileArgs returns the -f arguments for composeFile and, when it exists, the override file
+func composeFileArgs(composeFile string) []string {
+	args := []string{"-f", composeFile}
+	if override := composeOverridePath(composeFile); override != "" {
+		args = append(args, "-f", override)
+	}
+	return args
+}
+
+// confirmComposeOverwrite shows how the compose file config renders to differs from an existing
+// composeFile and asks before it is replaced. A replaced file is kept with a timestamp suffix.
+func confirmComposeOverwrite(reader *bufio.Reader, config Config, composeFile string) error {
+	if _, err := os.Stat(composeFile); err != nil {
 		return nil
 	}
 
-	return fmt.Errorf("Unsupported container type: %s", containerType)
+	dir, err := os.MkdirTemp("", "pangolin-compose-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := renderConfigFiles(config, dir); err != nil {
+		return err
+	}
+	rendered := filepath.Join(dir, "config/docker-compose.yml")
+
+	existing, err := os.ReadFile(composeFile)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", composeFile, err)
+	}
+	if generated, err := os.ReadFile(rendered); err == nil && bytes.Equal(existing, generated) {
+		return nil
+	}
+
+	logWarn("Warning: %s already exists and differs from the generated compose file:", composeFile)
+	printFileDiff(composeFile, rendered, secretValues(config))
+	if !confirm(reader, "overwrite-compose", "Replace "+composeFile+" with the generated compose file?", false) {
+		return fmt.Errorf("kept the existing %s, move it away or pass --overwrite-compose to replace it", composeFile)
+	}
+
+	backup := composeFile + "." + time.Now().Format("20060102-150405") + ".bak"
+	if err := copyFile(composeFile, backup); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", composeFile, err)
+	}
+	logInfo("Backed up %s to %s", composeFile, backup)
+	return nil
 }
 
 // startContainers starts the containers using the appropriate command.
 func startContainers(containerType SupportedContainer) error {
-	fmt.Println("Starting containers...")
+	logInfo("Starting containers...")
 
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
-			return fmt.Errorf("failed start containers: %v", err)
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	if containerType == Docker && *swarmFlag {
+		if err := run("docker", "stack", "deploy", "-c", composeFile, "--with-registry-auth", swarmStackName); err != nil {
+			return fmt.Errorf("failed to deploy the stack: %v", err)
 		}
 
 		return nil
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "up", "-d", "--force-recreate"); err != nil {
-			return fmt.Errorf("failed to start containers: %v", err)
+	if override := composeOverridePath(composeFile); override != "" {
+		logInfo("Applying the overrides from %s", override)
+	}
+
+	if containerType == Podman {
+		for _, warning := range checkPodmanCompatibility(composeFile) {
+			logWarn("Warning: %s", warning)
 		}
+	}
 
-		return nil
+	if err := executeContainerCommandWithArgs(containerType, append(composeFileArgs(composeFile), "up", "-d", "--force-recreate")...); err != nil {
+		return fmt.Errorf("failed to start containers: %v", err)
 	}
 
-	return fmt.Errorf("Unsupported container type: %s", containerType)
+	return nil
 }
 
 // stopContainers stops the containers using the appropriate command.
 func stopContainers(containerType SupportedContainer) error {
-	fmt.Println("Stopping containers...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "down"); err != nil {
-			return fmt.Errorf("failed to stop containers: %v", err)
+	logInfo("Stopping containers...")
+
+	if containerType == Docker && *swarmFlag {
+		if err := run("docker", "stack", "rm", swarmStackName); err != nil {
+			return fmt.Errorf("failed to remove the stack: %v", err)
 		}
 
 		return nil
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "down"); err != nil {
-			return fmt.Errorf("failed to stop containers: %v", err)
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := executeContainerCommandWithArgs(containerType, append(composeFileArgs(composeFile), "down")...); err != nil {
+		return fmt.Errorf("failed to stop containers: %v", err)
+	}
+
+	return nil
+}
+
+// removeContainers stops and removes the containers, optionally deleting their volumes too.
+func removeContainers(containerType SupportedContainer, removeVolumes bool) error {
+	if containerType == Docker && *swarmFlag {
+		// Stack volumes are not removed with the stack, so only the services go away
+		if err := run("docker", "stack", "rm", swarmStackName); err != nil {
+			return fmt.Errorf("failed to remove the stack: %v", err)
 		}
 
 		return nil
 	}
 
-	return fmt.Errorf("Unsupported container type: %s", containerType)
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	args := append(composeFileArgs(composeFile), "down")
+	if removeVolumes {
+		args = append(args, "-v")
+	}
+
+	if err := executeContainerCommandWithArgs(containerType, args...); err != nil {
+		return fmt.Errorf("failed to remove containers: %v", err)
+	}
+
+	return nil
 }
 
-// restartContainer restarts a specific container using the appropriate command.
-func restartContainer(container string, containerType SupportedContainer) error {
-	fmt.Println("Restarting containers...")
-	if containerType == Podman {
-		if err := run("podman-compose", "-f", "docker-compose.yml", "restart"); err != nil {
-			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
+// restartContainers restarts every service of the stack using the appropriate command.
+func restartContainers(containerType SupportedContainer) error {
+	logInfo("Restarting all containers...")
+
+	if containerType == Docker && *swarmFlag {
+		services, err := readComposeServices(*composeFileFlag)
+		if err != nil {
+			return err
+		}
+		for service := range services {
+			if err := run("docker", "service", "update", "--force", swarmServiceName(service)); err != nil {
+				return fmt.Errorf("failed to restart the service \"%s\": %v", service, err)
+			}
 		}
 
 		return nil
 	}
 
-	if containerType == Docker {
-		if err := executeDockerComposeCommandWithArgs("-f", "docker-compose.yml", "restart", container); err != nil {
-			return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := executeContainerCommandWithArgs(containerType, append(composeFileArgs(composeFile), "restart")...); err != nil {
+		return fmt.Errorf("failed to restart containers: %v", err)
+	}
+
+	return nil
+}
+
+// restartContainer restarts a specific container using the appropriate command.
+func restartContainer(container string, containerType SupportedContainer) error {
+	logInfo("Restarting containers...")
+
+	if containerType == Docker && *swarmFlag {
+		if err := run("docker", "service", "update", "--force", swarmServiceName(container)); err != nil {
+			return fmt.Errorf("failed to restart the service \"%s\": %v", container, err)
 		}
 
 		return nil
 	}
 
-	return fmt.Errorf("Unsupported container type: %s", containerType)
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	if err := executeContainerCommandWithArgs(containerType, append(composeFileArgs(composeFile), "restart", container)...); err != nil {
+		return fmt.Errorf("failed to stop the container \"%s\": %v", container, err)
+	}
+
+	return nil
+}
+
+// checkPodmanCompatibility returns warnings for compose directives that podman-compose
+// ignores or that need extra privileges under rootless Podman
+func checkPodmanCompatibility(composePath string) []string {
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var warnings []string
+	for _, name := range names {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if mode, ok := service["network_mode"].(string); ok && strings.HasPrefix(mode, "service:") {
+			warnings = append(warnings, fmt.Sprintf("%s uses network_mode %q, which needs podman-compose 1.1 or newer", name, mode))
+		}
+		if dependsOn, ok := service["depends_on"].(map[string]interface{}); ok {
+			for dependency, condition := range dependsOn {
+				if c, ok := condition.(map[string]interface{}); ok && c["condition"] == "service_healthy" {
+					warnings = append(warnings, fmt.Sprintf("%s waits for %s to be healthy, older podman-compose versions only wait for it to start", name, dependency))
+				}
+			}
+		}
+		if _, ok := service["deploy"]; ok {
+			warnings = append(warnings, fmt.Sprintf("%s has a deploy section, which podman-compose mostly ignores", name))
+		}
+		if caps, ok := service["cap_add"].([]interface{}); ok && os.Geteuid() != 0 {
+			for _, capability := range caps {
+				if capability == "SYS_MODULE" {
+					warnings = append(warnings, fmt.Sprintf("%s needs SYS_MODULE, which rootless Podman cannot grant", name))
+				}
+			}
+		}
+	}
+	return warnings
 }
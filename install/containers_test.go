@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeClock is a waitClock whose sleeps only advance its time
+type fakeClock struct {
+	current time.Time
+	sleeps  int
+}
+
+func (c *fakeClock) waitClock() waitClock {
+	return waitClock{
+		now: func() time.Time { return c.current },
+		sleep: func(d time.Duration) {
+			c.sleeps++
+			c.current = c.current.Add(d)
+		},
+	}
+}
+
+func TestPollUntilTimesOut(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	start := clock.current
+	checks := 0
+
+	ok := pollUntil(30*time.Second, 2*time.Second, clock.waitClock(), func() bool {
+		checks++
+		return false
+	})
+	if ok {
+		t.Fatal("pollUntil = true for a check that never succeeds")
+	}
+	if elapsed := clock.current.Sub(start); elapsed != 30*time.Second {
+		t.Errorf("pollUntil gave up after %s, want the 30s timeout", elapsed)
+	}
+	if checks != 15 || clock.sleeps != 15 {
+		t.Errorf("pollUntil checked %d times and slept %d times, want 15 each at a 2s interval", checks, clock.sleeps)
+	}
+}
+
+func TestPollUntilSucceedsBeforeDeadline(t *testing.T) {
+	clock := &fakeClock{current: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	checks := 0
+
+	ok := pollUntil(30*time.Second, 2*time.Second, clock.waitClock(), func() bool {
+		checks++
+		return checks == 3
+	})
+	if !ok {
+		t.Fatal("pollUntil = false for a check that succeeds on the third call")
+	}
+	if clock.sleeps != 2 {
+		t.Errorf("pollUntil slept %d times, want 2", clock.sleeps)
+	}
+}
+
+func TestWaitForContainerTimeout(t *testing.T) {
+	// The runtime cannot be started, so every check fails until the deadline
+	missing := SupportedContainer(filepath.Join(t.TempDir(), "missing-runtime"))
+
+	for name, wait := range map[string]func(string, SupportedContainer, time.Duration, time.Duration) error{
+		"waitForContainer":        waitForContainer,
+		"waitForContainerHealthy": waitForContainerHealthy,
+	} {
+		start := time.Now()
+		err := wait("pangolin", missing, 50*time.Millisecond, 10*time.Millisecond)
+		if err == nil || !strings.Contains(err.Error(), "within 50ms") {
+			t.Errorf("%s = %v, want a timeout error naming the 50ms timeout", name, err)
+		}
+		if elapsed := time.Since(start); elapsed < 50*time.Millisecond || elapsed > 5*time.Second {
+			t.Errorf("%s returned after %s, want right after the 50ms timeout", name, elapsed)
+		}
+	}
+}
+
+func TestComposeFileArgs(t *testing.T) {
+	dir := t.TempDir()
+	composeFile := filepath.Join(dir, "docker-compose.yml")
+
+	if got, want := composeFileArgs(composeFile), []string{"-f", composeFile}; !slices.Equal(got, want) {
+		t.Errorf("composeFileArgs without an override = %q, want %q", got, want)
+	}
+
+	override := filepath.Join(dir, composeOverrideFile)
+	if err := os.WriteFile(override, []byte("services: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := composeFileArgs(composeFile), []string{"-f", composeFile, "-f", override}; !slices.Equal(got, want) {
+		t.Errorf("composeFileArgs with an override = %q, want %q", got, want)
+	}
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -22,127 +25,122 @@ func installCrowdsec(config Config) error {
 		return fmt.Errorf("backup failed: %v", err)
 	}
 
-	if err := createConfigFiles(config); err != nil {
-		fmt.Printf("Error creating config files: %v\n", err)
-		os.Exit(1)
+	// The key is rendered into the Traefik config and registered with CrowdSec once it is up
+	config.TraefikBouncerKey = generateRandomSecretKey(defaultSecretLength, defaultSecretCharset)
+
+	if _, err := createConfigFiles(config); err != nil {
+		logError("Error creating config files: %v", err)
+		exit(1)
 	}
 
 	os.MkdirAll("config/crowdsec/db", 0755)
 	os.MkdirAll("config/crowdsec/acquis.d", 0755)
 	os.MkdirAll("config/traefik/logs", 0755)
 
-	if err := copyDockerService("config/crowdsec/docker-compose.yml", "docker-compose.yml", "crowdsec"); err != nil {
-		fmt.Printf("Error copying docker service: %v\n", err)
-		os.Exit(1)
+	if err := copyDockerService("config/crowdsec/docker-compose.yml", *composeFileFlag, "crowdsec"); err != nil {
+		logError("Error copying docker service: %v", err)
+		exit(1)
 	}
 
 	if err := MergeYAML("config/traefik/traefik_config.yml", "config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+		logError("Error copying entry points: %v", err)
+		exit(1)
 	}
 	// delete the 2nd file
 	if err := os.Remove("config/crowdsec/traefik_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		logError("Error removing file: %v", err)
+		exit(1)
 	}
 
 	if err := MergeYAML("config/traefik/dynamic_config.yml", "config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error copying entry points: %v\n", err)
-		os.Exit(1)
+		logError("Error copying entry points: %v", err)
+		exit(1)
 	}
 	// delete the 2nd file
 	if err := os.Remove("config/crowdsec/dynamic_config.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		logError("Error removing file: %v", err)
+		exit(1)
 	}
 
 	if err := os.Remove("config/crowdsec/docker-compose.yml"); err != nil {
-		fmt.Printf("Error removing file: %v\n", err)
-		os.Exit(1)
+		logError("Error removing file: %v", err)
+		exit(1)
 	}
 
-	if err := CheckAndAddTraefikLogVolume("docker-compose.yml"); err != nil {
-		fmt.Printf("Error checking and adding Traefik log volume: %v\n", err)
-		os.Exit(1)
+	if err := CheckAndAddTraefikLogVolume(*composeFileFlag); err != nil {
+		logError("Error checking and adding Traefik log volume: %v", err)
+		exit(1)
 	}
 
 	// check and add the service dependency of crowdsec to traefik
-	if err := CheckAndAddCrowdsecDependency("docker-compose.yml"); err != nil {
-		fmt.Printf("Error adding crowdsec dependency to traefik: %v\n", err)
-		os.Exit(1)
+	if err := CheckAndAddCrowdsecDependency(*composeFileFlag); err != nil {
+		logError("Error adding crowdsec dependency to traefik: %v", err)
+		exit(1)
 	}
 
 	if err := startContainers(config.InstallationContainerType); err != nil {
 		return fmt.Errorf("failed to start containers: %v", err)
 	}
 
-	// get API key
-	apiKey, err := GetCrowdSecAPIKey(config.InstallationContainerType)
-	if err != nil {
-		return fmt.Errorf("failed to get API key: %v", err)
-	}
-	config.TraefikBouncerKey = apiKey
-
-	if err := replaceInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK", config.TraefikBouncerKey); err != nil {
-		return fmt.Errorf("failed to replace bouncer key: %v", err)
-	}
-
-	if err := restartContainer("traefik", config.InstallationContainerType); err != nil {
-		return fmt.Errorf("failed to restart containers: %v", err)
-	}
-
-	if checkIfTextInFile("config/traefik/dynamic_config.yml", "PUT_YOUR_BOUNCER_KEY_HERE_OR_IT_WILL_NOT_WORK") {
-		fmt.Println("Failed to replace bouncer key! Please retrieve the key and replace it in the config/traefik/dynamic_config.yml file using the following command:")
-		fmt.Println("	docker exec crowdsec cscli bouncers add traefik-bouncer")
+	if err := registerCrowdSecBouncer(config.InstallationContainerType, config.TraefikBouncerKey); err != nil {
+		logError("Failed to register the Traefik bouncer: %v", err)
+		logInfo("Register it manually with the key from config/traefik/dynamic_config.yml:")
+		logInfo("	%s exec crowdsec cscli bouncers add %s --key <key>", config.InstallationContainerType, crowdsecBouncerName)
+		return fmt.Errorf("failed to register the Traefik bouncer: %v", err)
 	}
 
 	return nil
 }
 
-func checkIsCrowdsecInstalledInCompose() bool {
-	// Read docker-compose.yml
-	content, err := os.ReadFile("docker-compose.yml")
-	if err != nil {
-		return false
+// checkIsCrowdsecInstalledInCompose reports whether the compose file has a CrowdSec service, named
+// crowdsec or running the crowdsecurity/crowdsec image. A missing compose file has none.
+func checkIsCrowdsecInstalledInCompose(composePath string) (bool, error) {
+	if _, err := os.Stat(composePath); errors.Is(err, fs.ErrNotExist) {
+		return false, nil
 	}
 
-	// Check for crowdsec service
-	return bytes.Contains(content, []byte("crowdsec:"))
-}
-
-func GetCrowdSecAPIKey(containerType SupportedContainer) (string, error) {
-	// First, ensure the container is running
-	if err := waitForContainer("crowdsec", containerType); err != nil {
-		return "", fmt.Errorf("waiting for container: %w", err)
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return false, err
 	}
-
-	// Execute the command to get the API key
-	cmd := exec.Command("docker", "exec", "crowdsec", "cscli", "bouncers", "add", "traefik-bouncer", "-o", "raw")
-	var out bytes.Buffer
-	cmd.Stdout = &out
-
-	if err := cmd.Run(); err != nil {
-		return "", fmt.Errorf("executing command: %w", err)
+	for name, service := range services {
+		if name == "crowdsec" {
+			return true, nil
+		}
+		if service, ok := service.(map[string]interface{}); ok {
+			if image, _ := service["image"].(string); strings.Contains(image, "crowdsecurity/crowdsec") {
+				return true, nil
+			}
+		}
 	}
+	return false, nil
+}
 
-	// Trim any whitespace from the output
-	apiKey := strings.TrimSpace(out.String())
-	if apiKey == "" {
-		return "", fmt.Errorf("empty API key returned")
+// crowdsecBouncerName is the name the Traefik bouncer is registered under
+const crowdsecBouncerName = "traefik-bouncer"
+
+// registerCrowdSecBouncer registers key as the Traefik bouncer key with the CrowdSec container.
+// A bouncer left over from an earlier install is replaced.
+func registerCrowdSecBouncer(containerType SupportedContainer, key string) error {
+	if err := waitPatiently("crowdsec", containerType, waitForContainer); err != nil {
+		return fmt.Errorf("waiting for container: %w", err)
 	}
 
-	return apiKey, nil
-}
+	exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "delete", crowdsecBouncerName).Run()
 
-func checkIfTextInFile(file, text string) bool {
-	// Read file
-	content, err := os.ReadFile(file)
-	if err != nil {
-		return false
+	// The local API takes a moment to accept commands after the container started
+	var err error
+	for attempt := 0; attempt < 10; attempt++ {
+		var stderr bytes.Buffer
+		cmd := exec.Command(string(containerType), "exec", "crowdsec", "cscli", "bouncers", "add", crowdsecBouncerName, "--key", key)
+		cmd.Stderr = &stderr
+		if err = cmd.Run(); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		time.Sleep(3 * time.Second)
 	}
-
-	// Check for text
-	return bytes.Contains(content, []byte(text))
+	return fmt.Errorf("executing cscli: %w", err)
 }
 
 func CheckAndAddCrowdsecDependency(composePath string) error {
@@ -196,6 +194,6 @@ func CheckAndAddCrowdsecDependency(composePath string) error {
 		return fmt.Errorf("error writing updated compose file: %w", err)
 	}
 
-	fmt.Println("Added dependency of crowdsec to traefik")
+	logInfo("Added dependency of crowdsec to traefik")
 	return nil
 }
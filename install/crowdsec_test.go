@@ -0,0 +1,84 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckIsCrowdsecInstalledInCompose(t *testing.T) {
+	tests := []struct {
+		name    string
+		compose string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name: "service present",
+			compose: `services:
+  pangolin:
+    image: docker.io/fosrl/pangolin:1.0.0
+  crowdsec:
+    image: docker.io/crowdsecurity/crowdsec:latest
+`,
+			want: true,
+		},
+		{
+			name: "image under another name",
+			compose: `services:
+  security:
+    image: docker.io/crowdsecurity/crowdsec:latest
+`,
+			want: true,
+		},
+		{
+			name: "service absent",
+			compose: `services:
+  pangolin:
+    image: docker.io/fosrl/pangolin:1.0.0
+  traefik:
+    image: docker.io/traefik:v3.4
+`,
+			want: false,
+		},
+		{
+			name: "only mentioned in a comment",
+			compose: `services:
+  # crowdsec:
+  #   image: docker.io/crowdsecurity/crowdsec:latest
+  traefik:
+    image: docker.io/traefik:v3.4 # add crowdsec later
+`,
+			want: false,
+		},
+		{
+			name:    "invalid file",
+			compose: "services:\n  crowdsec: [\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "docker-compose.yml")
+			if err := os.WriteFile(path, []byte(tt.compose), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := checkIsCrowdsecInstalledInCompose(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkIsCrowdsecInstalledInCompose() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("checkIsCrowdsecInstalledInCompose() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		got, err := checkIsCrowdsecInstalledInCompose(filepath.Join(t.TempDir(), "docker-compose.yml"))
+		if err != nil || got {
+			t.Errorf("checkIsCrowdsecInstalledInCompose() = %v, %v, want false, nil", got, err)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// diagnosticsDir is the directory every entry of a diagnostics bundle is placed in
+const diagnosticsDir = "pangolin-diagnostics"
+
+// diagnosticsLogLines is the number of log lines collected of every service
+const diagnosticsLogLines = 500
+
+// diagnosticsConfigFiles are the generated files included in a diagnostics bundle, after redaction
+var diagnosticsConfigFiles = []string{
+	"config/config.yml",
+	"config/traefik/traefik_config.yml",
+	"config/traefik/dynamic_config.yml",
+	"config/crowdsec/profiles.yaml",
+}
+
+// secretLinePattern matches YAML and env lines whose key names a secret, for secrets the
+// installed config cannot be read back for, like the CrowdSec bouncer key
+var secretLinePattern = regexp.MustCompile(`(?im)^(\s*(?:-\s*)?[\w.-]*(?:secret|pass|token|key)[\w.-]*\s*[:=]\s*)(\S.*)$`)
+
+// redactDiagnostics masks the known secrets in text and blanks every value whose key names a
+// secret. Booleans like passHostHeader: true are kept, they are settings and not secrets.
+func redactDiagnostics(text string, secrets []string) string {
+	text = maskSecrets(text, secrets)
+	return secretLinePattern.ReplaceAllStringFunc(text, func(line string) string {
+		match := secretLinePattern.FindStringSubmatch(line)
+		if value := strings.ToLower(strings.TrimSpace(match[2])); value == "true" || value == "false" {
+			return line
+		}
+		return match[1] + "********"
+	})
+}
+
+// collectDiagnostics writes a tarball for bug reports with the compose status, recent service
+// logs, the redacted config and compose files, the runtime info, the OS release and the
+// installer version. Parts that cannot be collected are recorded in the bundle instead.
+func collectDiagnostics(archivePath string) error {
+	var secrets []string
+	if config, err := loadInstalledConfig(); err == nil {
+		secrets = secretValues(config)
+	} else {
+		logWarn("Warning: could not read the installed configuration, only secrets named by their keys are redacted: %v", err)
+	}
+
+	entries := make(map[string][]byte)
+	add := func(name string, content []byte) {
+		entries[name] = []byte(redactDiagnostics(string(content), secrets))
+	}
+
+	var version bytes.Buffer
+	printVersion(&version)
+	add("version.txt", version.Bytes())
+
+	if release, err := os.ReadFile("/etc/os-release"); err == nil {
+		add("os-release.txt", release)
+	} else {
+		add("os-release.txt", []byte(err.Error()+"\n"))
+	}
+
+	for _, path := range append(diagnosticsConfigFiles, *composeFileFlag, composeOverridePath(*composeFileFlag)) {
+		if path == "" {
+			continue
+		}
+		name := strings.TrimPrefix(filepath.ToSlash(path), "/")
+		if content, err := os.ReadFile(path); err == nil {
+			add(name, content)
+		} else if !os.IsNotExist(err) {
+			add(name+".error", []byte(err.Error()+"\n"))
+		}
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		add("runtime.txt", []byte("neither Docker nor Podman is installed\n"))
+	} else {
+		add("runtime-info.txt", diagnosticsCommand(exec.Command(string(containerType), "info")))
+		add("compose-ps.txt", diagnosticsComposePs(containerType))
+
+		if services, err := readComposeServices(*composeFileFlag); err == nil {
+			for service := range services {
+				logs, err := recentContainerLogs(service, containerType, diagnosticsLogLines)
+				if err != nil {
+					logs = logs + "\n" + err.Error() + "\n"
+				}
+				add("logs/"+service+".log", []byte(logs))
+			}
+		} else {
+			add("logs/error.txt", []byte(err.Error()+"\n"))
+		}
+	}
+
+	if err := writeDiagnosticsArchive(archivePath, entries); err != nil {
+		return err
+	}
+	logInfo("Diagnostics written to %s, review it before attaching it to a bug report.", archivePath)
+	return nil
+}
+
+// diagnosticsComposePs returns the compose status of the stack, or the tasks of the stack on a swarm
+func diagnosticsComposePs(containerType SupportedContainer) []byte {
+	if *swarmFlag && containerType == Docker {
+		return diagnosticsCommand(exec.Command("docker", "stack", "ps", "--no-trunc", swarmStackName))
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+	cmd, err := composeCommand(ctx, containerType, append(composeFileArgs(*composeFileFlag), "ps", "--all")...)
+	if err != nil {
+		return []byte(err.Error() + "\n")
+	}
+	return diagnosticsCommand(cmd)
+}
+
+// diagnosticsCommand returns the combined output of cmd, followed by its error when it failed
+func diagnosticsCommand(cmd *exec.Cmd) []byte {
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		out = append(out, []byte(fmt.Sprintf("\n%s failed: %v\n", strings.Join(cmd.Args, " "), err))...)
+	}
+	return out
+}
+
+// writeDiagnosticsArchive writes the entries to a gzipped tarball below diagnosticsDir
+func writeDiagnosticsArchive(archivePath string, entries map[string][]byte) error {
+	file, err := os.OpenFile(archivePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", archivePath, err)
+	}
+	defer file.Close()
+
+	gzipWriter := gzip.NewWriter(file)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	names := make([]string, 0, len(entries))
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	now := time.Now()
+	for _, name := range names {
+		header := &tar.Header{
+			Name:    diagnosticsDir + "/" + name,
+			Mode:    0600,
+			Size:    int64(len(entries[name])),
+			ModTime: now,
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write %s: %v", archivePath, err)
+		}
+		if _, err := tarWriter.Write(entries[name]); err != nil {
+			return fmt.Errorf("failed to write %s: %v", archivePath, err)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", archivePath, err)
+	}
+	if err := gzipWriter.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", archivePath, err)
+	}
+	return file.Close()
+}
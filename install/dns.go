@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// dnsProvider describes a DNS-01 provider the installer knows how to talk to
+type dnsProvider struct {
+	// TokenEnv is the environment variable Traefik (lego) reads the credentials from
+	TokenEnv string
+	// HasZone makes a read-only API call and reports whether the zone is manageable with the token
+	HasZone func(client *http.Client, token, zone string) (bool, error)
+}
+
+var dnsProviders = map[string]dnsProvider{
+	"cloudflare": {
+		TokenEnv: "CF_DNS_API_TOKEN",
+		HasZone: func(client *http.Client, token, zone string) (bool, error) {
+			var result struct {
+				Result []struct {
+					Name string `json:"name"`
+				} `json:"result"`
+			}
+			req, _ := http.NewRequest("GET", "https://api.cloudflare.com/client/v4/zones?name="+url.QueryEscape(zone), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			if _, err := doDNSProviderRequest(client, req, &result); err != nil {
+				return false, err
+			}
+			return len(result.Result) > 0, nil
+		},
+	},
+	"digitalocean": {
+		TokenEnv: "DO_AUTH_TOKEN",
+		HasZone: func(client *http.Client, token, zone string) (bool, error) {
+			req, _ := http.NewRequest("GET", "https://api.digitalocean.com/v2/domains/"+url.PathEscape(zone), nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			status, err := doDNSProviderRequest(client, req, nil)
+			if status == http.StatusNotFound {
+				return false, nil
+			}
+			return err == nil, err
+		},
+	},
+	"hetzner": {
+		TokenEnv: "HETZNER_API_KEY",
+		HasZone: func(client *http.Client, token, zone string) (bool, error) {
+			var result struct {
+				Zones []struct {
+					Name string `json:"name"`
+				} `json:"zones"`
+			}
+			req, _ := http.NewRequest("GET", "https://dns.hetzner.com/api/v1/zones?name="+url.QueryEscape(zone), nil)
+			req.Header.Set("Auth-API-Token", token)
+			status, err := doDNSProviderRequest(client, req, &result)
+			if status == http.StatusNotFound {
+				return false, nil
+			}
+			if err != nil {
+				return false, err
+			}
+			return len(result.Zones) > 0, nil
+		},
+	},
+}
+
+// dnsProviderNames returns the supported provider names in a stable order
+func dnsProviderNames() []string {
+	var names []string
+	for name := range dnsProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// dnsProviderToken returns the credentials for a provider from --dns-api-token or the provider's environment variable
+func dnsProviderToken(provider dnsProvider) string {
+	if *dnsAPITokenFlag != "" {
+		return *dnsAPITokenFlag
+	}
+	return os.Getenv(provider.TokenEnv)
+}
+
+// testDNSProvider checks that the DNS provider credentials work and can manage the zone of baseDomain
+func testDNSProvider(providerName, baseDomain string, report *Report) error {
+	provider, ok := dnsProviders[providerName]
+	if !ok {
+		return fmt.Errorf("unsupported DNS provider %q: must be one of %s", providerName, strings.Join(dnsProviderNames(), ", "))
+	}
+
+	token := dnsProviderToken(provider)
+	if token == "" {
+		return fmt.Errorf("no credentials for %s: set %s or pass --dns-api-token", providerName, provider.TokenEnv)
+	}
+
+	client := &http.Client{
+		Timeout: 10 * time.Second,
+	}
+
+	// The zone may be a parent of the base domain, so walk up until only the registrable part is left
+	labels := strings.Split(strings.TrimSuffix(baseDomain, "."), ".")
+	for i := 0; i < len(labels)-1; i++ {
+		zone := strings.Join(labels[i:], ".")
+		found, err := provider.HasZone(client, token, zone)
+		if err != nil {
+			report.AddCheck("credentials", false, err.Error())
+			return fmt.Errorf("%s API call failed: %v", providerName, err)
+		}
+		if found {
+			report.AddCheck("credentials", true, providerName+" accepted the API token")
+			report.AddCheck("zone", true, zone+" is manageable")
+			return nil
+		}
+	}
+
+	report.AddCheck("credentials", true, providerName+" accepted the API token")
+	report.AddCheck("zone", false, "no zone covering "+baseDomain)
+	return fmt.Errorf("credentials for %s are valid but no zone covering %s was found", providerName, baseDomain)
+}
+
+// doDNSProviderRequest runs a provider API request, decodes a successful JSON response into result
+// and turns error responses into an error containing the provider's message
+func doDNSProviderRequest(client *http.Client, req *http.Request, result interface{}) (int, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return resp.StatusCode, fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		message := strings.TrimSpace(string(body))
+		if len(message) > 300 {
+			message = message[:300] + "..."
+		}
+		return resp.StatusCode, fmt.Errorf("HTTP %d: %s", resp.StatusCode, message)
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(body, result); err != nil {
+			return resp.StatusCode, fmt.Errorf("failed to parse response: %v", err)
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// dnsLookupTimeout bounds the pre-flight resolution of the dashboard domain
+const dnsLookupTimeout = 5 * time.Second
+
+// checkDNS resolves the A and AAAA records of the dashboard domain and returns an error
+// when none of them is an address of this server. The server addresses are the interface
+// addresses plus the public IP, which is looked up best effort for hosts behind NAT.
+func checkDNS(config Config) error {
+	ctx, cancel := context.WithTimeout(context.Background(), dnsLookupTimeout)
+	defer cancel()
+
+	resolved, err := net.DefaultResolver.LookupIPAddr(ctx, config.DashboardDomain)
+	if err != nil {
+		return fmt.Errorf("could not resolve %s: %v", config.DashboardDomain, err)
+	}
+
+	own := make(map[string]bool)
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok {
+				own[ipNet.IP.String()] = true
+			}
+		}
+	}
+	publicIP := getPublicIP()
+	if publicIP != "" {
+		own[net.ParseIP(publicIP).String()] = true
+	}
+
+	var records []string
+	for _, addr := range resolved {
+		if own[addr.IP.String()] {
+			return nil
+		}
+		records = append(records, addr.IP.String())
+	}
+
+	if publicIP == "" {
+		return fmt.Errorf("%s resolves to %s, which is not an address of this server (its public IP could not be determined)", config.DashboardDomain, strings.Join(records, ", "))
+	}
+	return fmt.Errorf("%s resolves to %s, but the public IP of this server is %s", config.DashboardDomain, strings.Join(records, ", "), publicIP)
+}
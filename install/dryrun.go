@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// dryRun renders the config files into a temporary directory and prints what would be
+// written compared to the current installation. It returns the temporary directory.
+func dryRun(config Config) (string, error) {
+	dir, err := os.MkdirTemp("", "pangolin-dry-run-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+
+	if err := renderConfigFiles(config, dir); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+
+	// Mirror the install, which moves the compose file to the top level
+	if err := os.Rename(filepath.Join(dir, "config/docker-compose.yml"), filepath.Join(dir, "docker-compose.yml")); err != nil {
+		os.RemoveAll(dir)
+		return "", fmt.Errorf("failed to move docker-compose.yml: %v", err)
+	}
+
+	logInfo("\n=== Dry run: files rendered to %s ===", dir)
+
+	// The diff shows the rendered and the installed secrets, mask both
+	secrets := secretValues(config)
+	if installed, err := loadInstalledConfig(); err == nil {
+		secrets = append(secrets, secretValues(installed)...)
+	} else if secret, err := installedSecret(); err == nil {
+		secrets = append(secrets, secret)
+	}
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		if info.IsDir() {
+			logInfo("  %s/", rel)
+			return nil
+		}
+
+		rendered, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		existing, err := os.ReadFile(rel)
+		switch {
+		case os.IsNotExist(err):
+			logInfo("  %s (new)", rel)
+		case err != nil:
+			return err
+		case bytes.Equal(existing, rendered):
+			logInfo("  %s (unchanged)", rel)
+		default:
+			logInfo("  %s (changed)", rel)
+			printFileDiff(rel, path, secrets)
+		}
+		return nil
+	})
+	if err != nil {
+		return dir, fmt.Errorf("failed to inspect rendered files: %v", err)
+	}
+
+	logInfo("\nDry run complete, Docker was not touched.")
+	return dir, nil
+}
+
+// printFileDiff prints a unified diff from oldPath to newPath with the secrets masked. Nothing
+// is printed when diff is not installed.
+func printFileDiff(oldPath, newPath string, secrets []string) {
+	if _, err := exec.LookPath("diff"); err != nil {
+		return
+	}
+	// diff exits 1 when the files differ
+	output, _ := exec.Command("diff", "-u", oldPath, newPath).CombinedOutput()
+	for _, line := range strings.Split(strings.TrimRight(maskSecrets(string(output), secrets), "\n"), "\n") {
+		logInfo("%s", line)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// activeCommands tracks the long-running commands so an interrupt can kill them
+var activeCommands = struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]struct{}
+}{cmds: make(map[*exec.Cmd]struct{})}
+
+// interruptState holds what the interrupt handler has to undo besides the running commands
+var interruptState = struct {
+	sync.Mutex
+	// terminal is the state to restore while a hidden prompt has turned echo off
+	terminal *term.State
+	// cleanup is set while a fresh install is starting its containers
+	cleanup func()
+}{}
+
+// setInterruptCleanup registers a function the interrupt handler runs before exiting, nil removes it
+func setInterruptCleanup(cleanup func()) {
+	interruptState.Lock()
+	interruptState.cleanup = cleanup
+	interruptState.Unlock()
+}
+
+// handleInterrupts kills the process groups of the running commands on Ctrl-C or SIGTERM
+// and exits, so no package manager or compose process is left orphaned
+func handleInterrupts() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		// A second Ctrl-C during the cleanup exits right away
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+
+		interruptState.Lock()
+		terminal, cleanup := interruptState.terminal, interruptState.cleanup
+		interruptState.Unlock()
+		if terminal != nil {
+			term.Restore(int(os.Stdin.Fd()), terminal)
+		}
+
+		logInfo("\nInterrupted, stopping running commands...")
+
+		activeCommands.Lock()
+		for cmd := range activeCommands.cmds {
+			killProcessGroup(cmd)
+		}
+		activeCommands.Unlock()
+
+		if cleanup != nil {
+			cleanup()
+		}
+		exit(130)
+	}()
+}
+
+// commandContext returns a context that ends after --command-timeout
+func commandContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), *commandTimeoutFlag)
+}
+
+// newCommand creates a command in its own process group that is killed, together with
+// all of its subprocesses, once ctx ends
+func newCommand(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+	cmd.WaitDelay = 5 * time.Second
+	return cmd
+}
+
+// runCommandContext runs a command created by newCommand and reports a timeout as such
+func runCommandContext(ctx context.Context, cmd *exec.Cmd) error {
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	activeCommands.Lock()
+	activeCommands.cmds[cmd] = struct{}{}
+	activeCommands.Unlock()
+
+	err := cmd.Wait()
+
+	activeCommands.Lock()
+	delete(activeCommands.cmds, cmd)
+	activeCommands.Unlock()
+
+	if writer, ok := cmd.Stdout.(*logLineWriter); ok {
+		writer.Flush()
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%s did not finish within %s (see --command-timeout)", filepath.Base(cmd.Path), *commandTimeoutFlag)
+	}
+	return err
+}
@@ -0,0 +1,24 @@
+//go:build !unix
+
+package main
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op where process groups are not available
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup kills the command itself where process groups are not available
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	return cmd.Process.Kill()
+}
+
+// fileOwner is only available where files have numeric owners
+func fileOwner(info os.FileInfo) (uid int, gid int, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// firewalldServicePorts are the ports the predefined firewalld services open
+var firewalldServicePorts = map[string]int{
+	"http":  80,
+	"https": 443,
+}
+
+// checkFirewall returns a warning with the command to open each of the TCP ports that ufw or
+// firewalld blocks. It is best-effort: without either firewall, when it is inactive or when its
+// rules cannot be read, nothing is reported.
+func checkFirewall(ports []int) []string {
+	if _, err := exec.LookPath("ufw"); err == nil {
+		if warnings, ok := checkUfw(ports); ok {
+			return warnings
+		}
+	}
+	if _, err := exec.LookPath("firewall-cmd"); err == nil {
+		if warnings, ok := checkFirewalld(ports); ok {
+			return warnings
+		}
+	}
+	return nil
+}
+
+// checkUfw reports the ports an active ufw blocks, ok is false when ufw is inactive or its
+// status cannot be read, which needs root
+func checkUfw(ports []int) (warnings []string, ok bool) {
+	out, err := exec.Command("ufw", "status", "verbose").Output()
+	if err != nil {
+		return nil, false
+	}
+	status := string(out)
+	if !strings.Contains(status, "Status: active") {
+		return nil, false
+	}
+	if strings.Contains(status, "allow (incoming)") {
+		return nil, true
+	}
+
+	for _, port := range ports {
+		if !ufwAllows(status, port) {
+			warnings = append(warnings, fmt.Sprintf("ufw blocks incoming connections to port %d, open it with: ufw allow %d/tcp", port, port))
+		}
+	}
+	return warnings, true
+}
+
+// ufwAllows reports whether a rule of the ufw status allows TCP connections to port. Rules of
+// application profiles like "Nginx Full" are not resolved.
+func ufwAllows(status string, port int) bool {
+	for _, line := range strings.Split(status, "\n") {
+		// IPv6 rules are listed as "80/tcp (v6) ALLOW IN Anywhere (v6)"
+		fields := strings.Fields(strings.Replace(line, " (v6)", "", 1))
+		if len(fields) < 2 || fields[1] != "ALLOW" {
+			continue
+		}
+		spec, protocol, _ := strings.Cut(fields[0], "/")
+		if protocol != "" && protocol != "tcp" {
+			continue
+		}
+		for _, part := range strings.Split(spec, ",") {
+			if portInRange(part, ":", port) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkFirewalld reports the ports the default zone of a running firewalld blocks, ok is false
+// when firewalld is not running or its zone cannot be read
+func checkFirewalld(ports []int) (warnings []string, ok bool) {
+	if out, err := exec.Command("firewall-cmd", "--state").Output(); err != nil || strings.TrimSpace(string(out)) != "running" {
+		return nil, false
+	}
+	openPorts, err := exec.Command("firewall-cmd", "--list-ports").Output()
+	if err != nil {
+		return nil, false
+	}
+	services, err := exec.Command("firewall-cmd", "--list-services").Output()
+	if err != nil {
+		return nil, false
+	}
+
+	allowed := make(map[int]bool)
+	for _, service := range strings.Fields(string(services)) {
+		if port, ok := firewalldServicePorts[service]; ok {
+			allowed[port] = true
+		}
+	}
+	for _, port := range ports {
+		for _, entry := range strings.Fields(string(openPorts)) {
+			spec, protocol, _ := strings.Cut(entry, "/")
+			if protocol == "tcp" && portInRange(spec, "-", port) {
+				allowed[port] = true
+			}
+		}
+		if !allowed[port] {
+			warnings = append(warnings, fmt.Sprintf("firewalld blocks incoming connections to port %d, open it with: firewall-cmd --permanent --add-port=%d/tcp && firewall-cmd --reload", port, port))
+		}
+	}
+	return warnings, true
+}
+
+// portInRange reports whether spec, a port or a range of two ports joined by separator, includes port
+func portInRange(spec string, separator string, port int) bool {
+	low, high, isRange := strings.Cut(spec, separator)
+	if !isRange {
+		high = low
+	}
+	from, err := strconv.Atoi(low)
+	if err != nil {
+		return false
+	}
+	to, err := strconv.Atoi(high)
+	if err != nil {
+		return false
+	}
+	return from <= port && port <= to
+}
+
+// firewallReport checks the web ports for --check-firewall
+func firewallReport(report *Report) error {
+	warnings := checkFirewall([]int{80, 443})
+	for _, warning := range warnings {
+		report.Warn("%s", warning)
+	}
+	if len(warnings) > 0 {
+		return fmt.Errorf("%d web port(s) are blocked by the firewall, Let's Encrypt cannot validate the domains", len(warnings))
+	}
+	report.Message = "No ufw or firewalld rule blocks ports 80 and 443."
+	return nil
+}
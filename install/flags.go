@@ -0,0 +1,497 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	versionFlag = flag.Bool("version", false, "Print the Pangolin, Gerbil and Badger versions this installer deploys and exit")
+
+	configFileFlag      = flag.String("config-file", "", "Read the answers from a YAML file instead of prompting")
+	generateAnswersFlag = flag.String("generate-answers", "", "Write the collected answers to this YAML file for use with --config-file")
+	includeSecretsFlag  = flag.Bool("include-secrets", false, "Keep the SMTP password and DNS API token in the --generate-answers file")
+
+	dryRunFlag     = flag.Bool("dry-run", false, "Render the config files to a temporary directory and show what would change, without installing")
+	keepDryRunFlag = flag.Bool("keep-dry-run", false, "Keep the temporary directory of --dry-run for inspection")
+
+	regenerateFlag = flag.String("regenerate", "", "Re-render only this group of config files (traefik or pangolin) from the existing installation, keeping .bak copies")
+
+	exportComposeFlag = flag.Bool("export-compose", false, "Print the compose file rendered from the answers and flags and exit, without writing config/ or touching the containers")
+	outputFlag        = flag.String("output", "", "Write the --export-compose output to this file instead of stdout")
+
+	printConfigFlag = flag.Bool("print-config", false, "Print the effective configuration from the answers, flags and environment as YAML (secrets masked) and exit")
+
+	reconcileFlag = flag.Bool("reconcile", false, "Apply configuration changes to an existing installation and restart the affected containers")
+
+	statusFlag       = flag.Bool("status", false, "Show the state, health and uptime of every service and exit")
+	listServicesFlag = flag.Bool("list-services", false, "Print the image and published ports of every service in the compose file and exit")
+	restartFlag      = flag.Bool("restart", false, "Restart the whole stack and wait for the core services")
+	updateFlag       = flag.Bool("update", false, "Pull newer images and recreate the containers of an existing installation")
+	reinstallFlag    = flag.Bool("reinstall-containers", false, "Pull the images of the current compose file again and recreate the containers, keeping the configuration")
+	repairPermsFlag  = flag.Bool("repair-permissions", false, "Give the data directories in config/ to the users the containers run as, make acme.json mode 600 and exit")
+
+	collectDiagnosticsFlag = flag.String("collect-diagnostics", "", "Write a tarball with the service logs, the redacted config and compose files and system info for bug reports to this file and exit")
+
+	checkFirewallFlag = flag.Bool("check-firewall", false, "Check whether ufw or firewalld allows incoming connections to ports 80 and 443 and exit")
+
+	serviceLogsFlag = flag.String("service-logs", "", "Follow the logs of this compose service until Ctrl-C")
+	tailFlag        = flag.String("tail", "all", "Number of log lines --service-logs shows before following (or all)")
+
+	checkUpdatesFlag = flag.Bool("check-updates", false, "Compare the deployed Pangolin, Gerbil and Badger versions with the latest releases and exit")
+	versionsURLFlag  = flag.String("versions-url", "", "JSON manifest with the latest versions for --check-updates (default: the GitHub releases)")
+
+	selfUpdateFlag = flag.Bool("self-update", false, "Replace this installer with the build of the latest release, verified by its checksum, and exit")
+
+	backupFlag  = flag.String("backup", "", "Write a timestamped archive of the configuration and database to this directory and exit")
+	restoreFlag = flag.String("restore", "", "Restore an archive created by --backup into the current directory and start the stack")
+
+	listBackupsFlag     = flag.String("list-backups", "", "List the archives created by --backup in this directory with their versions and exit")
+	backupRetentionFlag = flag.Int("backup-retention", 0, "With --backup, delete all but the newest N backups in the directory (default: keep all)")
+	allowUncheckedFlag  = flag.Bool("allow-unchecked", false, "Let verify-backup pass when sqlite3 is missing and the database integrity cannot be checked")
+
+	uninstallFlag     = flag.Bool("uninstall", false, "Remove the containers and optionally the generated configuration")
+	forceFlag         = flag.Bool("force", false, "Skip confirmation prompts of destructive operations")
+	removeVolumesFlag = flag.Bool("remove-volumes", false, "Also remove container volumes when uninstalling")
+
+	metricsFlag      = flag.Bool("metrics", false, "Expose Traefik Prometheus metrics on a dedicated entrypoint")
+	metricsPortFlag  = flag.Int("metrics-port", 8082, "Port of the Traefik metrics entrypoint")
+	metricsAllowFlag = flag.String("metrics-allow", "", "Comma separated IPs/CIDRs allowed to scrape metrics (default: no restriction)")
+
+	logMaxSizeFlag  = flag.String("log-max-size", "100M", "Rotate log files once they reach this size (K, M or G suffix)")
+	logMaxAgeFlag   = flag.String("log-max-age", "14d", "Delete rotated log files older than this (e.g. 14d or 72h)")
+	logMaxFilesFlag = flag.Int("log-max-files", 7, "Number of rotated log files to keep")
+
+	acmeStagingFlag  = flag.Bool("acme-staging", false, "Request untrusted test certificates from the Let's Encrypt staging CA, which has much higher rate limits")
+	acmeCaServerFlag = flag.String("acme-ca-server", "", "ACME directory URL to request the certificates from (default: Let's Encrypt production)")
+
+	dnsProviderFlag = flag.String("dns-provider", "", "Issue the certificates with the DNS-01 challenge of this provider (cloudflare, digitalocean or hetzner), also used by the DNS provider test")
+	dnsAPITokenFlag = flag.String("dns-api-token", "", "API token for the DNS provider (default: read from the provider's environment variable)")
+
+	appEntrypointFlag = flag.String("app-entrypoint", "", "Override the Pangolin container entrypoint (advanced, for debugging)")
+	appCommandFlag    = flag.String("app-command", "", "Override the Pangolin container command (advanced, for debugging)")
+
+	noBindWebPortsFlag = flag.Bool("no-bind-web-ports", false, "Leave ports 80 and 443 to your own reverse proxy and publish Traefik on 127.0.0.1:8880 and 127.0.0.1:8443 (needs the DNS-01 challenge)")
+
+	dbBackendFlag    = flag.String("db-backend", "", "Database of Pangolin: sqlite (default) or postgres for an external PostgreSQL server")
+	postgresHostFlag = flag.String("postgres-host", "", "Host of the external PostgreSQL server (implies --db-backend postgres)")
+	postgresPortFlag = flag.Int("postgres-port", 5432, "Port of the external PostgreSQL server")
+	postgresUserFlag = flag.String("postgres-user", "", "User of the external PostgreSQL server, the password is read from PANGOLIN_POSTGRES_PASS")
+	postgresDBFlag   = flag.String("postgres-db", "pangolin", "Database name on the external PostgreSQL server")
+
+	siteFlag = repeatedFlagVar("site", "Additional base domain for resources besides the base domain, repeat the flag for several (e.g. --site example.net --site example.dev)")
+
+	timezoneFlag = flag.String("timezone", "", "IANA time zone of the containers, e.g. Europe/Berlin (default: the time zone of this host)")
+
+	bindAddressFlag = flag.String("bind-address", "", "Publish the ports of the stack only on this local IP address instead of all addresses")
+
+	imageLockFlag      = flag.String("image-lock", "", "Pin the images to the digests of this lock file instead of their version tags")
+	writeImageLockFlag = flag.String("write-image-lock", "", "Record the digests of the pulled images in this lock file, for later installs with --image-lock")
+
+	registryFlag = flag.String("registry", "", "Pull the images from this registry mirror instead of docker.io (e.g. registry.example.com:5000/mirror)")
+
+	composeFileFlag = flag.String("compose-file", "docker-compose.yml", "Compose file of the stack, for installations that keep it elsewhere")
+
+	swarmFlag = flag.Bool("swarm", false, "Deploy the stack to an existing Docker Swarm with docker stack deploy")
+
+	resultFileFlag = flag.String("result-file", "", "Write a JSON summary of the install run to this file (e.g. config/install-result.json), also when it fails")
+
+	logFileFlag  = flag.String("log-file", "", "Also write the installer output to this file")
+	jsonLogsFlag = flag.Bool("json-logs", false, "Print the installer output as JSON records (time, level, message, step)")
+
+	noColorFlag = flag.Bool("no-color", false, "Disable colored output (also disabled by NO_COLOR or when not writing to a terminal)")
+
+	reportFormatFlag = flag.String("report-format", "text", "Output format of the subcommands (text or json)")
+
+	secretLengthFlag = flag.Int("secret-length", defaultSecretLength, "Length of the generated server secret (at least 16)")
+
+	commandTimeoutFlag = flag.Duration("command-timeout", 10*time.Minute, "Abort package installs and container commands that run longer than this")
+
+	runtimeFlag = flag.String("runtime", "", "Container runtime to use (docker or podman), skips the runtime prompt")
+
+	containerWaitTimeoutFlag = flag.Duration("container-wait-timeout", time.Minute, "How long to wait for a container to start before showing its logs and asking whether to keep waiting")
+	containerWaitExtendFlag  = flag.Duration("container-wait-extend", time.Minute, "How much longer to wait each time you choose to keep waiting for a container")
+	healthcheckTimeoutFlag   = flag.Duration("healthcheck-timeout", time.Minute, "Alias of --container-wait-timeout")
+	healthcheckIntervalFlag  = flag.Duration("healthcheck-interval", 2*time.Second, "How often to check whether a container is running and healthy while waiting for it")
+
+	httpProxyFlag  = flag.String("http-proxy", "", "Proxy for HTTP requests of the installer, package manager and container runtime (default: HTTP_PROXY)")
+	httpsProxyFlag = flag.String("https-proxy", "", "Proxy for HTTPS requests of the installer, package manager and container runtime (default: HTTPS_PROXY)")
+	noProxyFlag    = flag.String("no-proxy", "", "Comma separated hosts that bypass the proxy (default: NO_PROXY)")
+
+	pullRetriesFlag = flag.Int("pull-retries", 3, "How often to retry pulling the images after a network error")
+
+	packageLockTimeoutFlag = flag.Duration("package-lock-timeout", 5*time.Minute, "How long to wait for another package manager run, e.g. unattended-upgrades, before installing Docker")
+
+	skipDockerInstallFlag = flag.Bool("skip-docker-install", false, "Never install Docker, exit with instructions if it is missing")
+
+	showPasswordFlag = flag.Bool("show-password", false, "Echo passwords while typing them (only in trusted environments)")
+
+	yesFlag      = flag.Bool("yes", false, "Answer every prompt with its default, failing on prompts without one")
+	yesShortFlag = flag.Bool("y", false, "Shorthand for --yes")
+
+	quietFlag = flag.Bool("quiet", false, "Never prompt, answer every question from flags and --config-file and fail if one is missing")
+
+	// Decisions normally asked interactively, only used when passed explicitly
+	installContainersFlag      = flag.Bool("install-containers", false, "Install and start the containers (default: prompt)")
+	installDockerFlag          = flag.Bool("install-docker", false, "Install Docker when it is missing (default: prompt)")
+	unprivilegedPortsFlag      = flag.Bool("unprivileged-ports", false, "Let rootless Podman listen on ports >= 80 by editing /etc/sysctl.conf (default: prompt)")
+	startDockerFlag            = flag.Bool("start-docker", false, "Start the Docker service when it is installed but not running (default: prompt)")
+	ignorePortConflictsFlag    = flag.Bool("ignore-port-conflicts", false, "Start the containers even if ports 80/443 are in use (default: prompt)")
+	ignoreLowResourcesFlag     = flag.Bool("ignore-low-resources", false, "Install even if the server has less memory or disk space than recommended (default: prompt)")
+	allowAnyEmailFlag          = flag.Bool("allow-any-email", false, "Use a Let's Encrypt email at a disposable or placeholder domain (default: prompt)")
+	allowExternalDashboardFlag = flag.Bool("allow-external-dashboard-domain", false, "Use a dashboard domain that is not the base domain or a subdomain of it (default: prompt)")
+	ignoreDNSMismatchFlag      = flag.Bool("ignore-dns-mismatch", false, "Start the containers even if the dashboard domain does not resolve to this server (default: prompt)")
+	resumeFlag                 = flag.Bool("resume", false, "Continue an install that was interrupted after writing the configuration (default: prompt)")
+	rollbackFlag               = flag.Bool("rollback", false, "Remove the generated configuration when the containers fail to start (default: prompt)")
+	updateMaxMindFlag          = flag.Bool("update-maxmind", false, "Download the MaxMind GeoLite2 database on an existing installation (default: prompt)")
+	restartServicesFlag        = flag.Bool("restart-services", false, "Restart the services whose files --regenerate rewrote (default: prompt)")
+	overwriteComposeFlag       = flag.Bool("overwrite-compose", false, "Replace an existing compose file that differs from the generated one, keeping a timestamped backup (default: prompt)")
+	ignoreDBUnreachableFlag    = flag.Bool("ignore-db-unreachable", false, "Install even if the PostgreSQL server cannot be reached (default: prompt)")
+	installCrowdsecFlag        = flag.Bool("install-crowdsec", false, "Install CrowdSec (default: prompt)")
+	stopContainersFlag         = flag.Bool("stop-containers", false, "Stop the running containers while --backup takes the snapshot (default: prompt)")
+
+	// Shorthands for --install-crowdsec=true and --install-crowdsec=false
+	enableCrowdsecFlag  = flag.Bool("enable-crowdsec", false, "Install CrowdSec without asking, accepting that you manage it")
+	disableCrowdsecFlag = flag.Bool("disable-crowdsec", false, "Skip the CrowdSec install without asking")
+
+	componentsFlag = flag.String("components", "", "Comma separated optional components to install (gerbil, email, crowdsec or none) instead of the component selection")
+
+	assumeDistroFlag = flag.String("assume-distro", "", "Install Docker as if running on this distribution (ubuntu, debian, fedora, rhel, alpine or arch)")
+)
+
+// assumableDistros are the installDocker branches that --assume-distro can force
+var assumableDistros = []string{"ubuntu", "debian", "fedora", "rhel", "alpine", "arch"}
+
+// validateFlags checks the flags that are not backed by Config
+func validateFlags() error {
+	if *assumeDistroFlag != "" && !slices.Contains(assumableDistros, *assumeDistroFlag) {
+		return fmt.Errorf("invalid --assume-distro value %q: must be one of %s", *assumeDistroFlag, strings.Join(assumableDistros, ", "))
+	}
+	if *secretLengthFlag < minSecretLength {
+		return fmt.Errorf("invalid --secret-length %d: must be at least %d", *secretLengthFlag, minSecretLength)
+	}
+	if *runtimeFlag != "" && *runtimeFlag != "docker" && *runtimeFlag != "podman" {
+		return fmt.Errorf("invalid --runtime value %q: must be docker or podman", *runtimeFlag)
+	}
+	if *commandTimeoutFlag <= 0 {
+		return fmt.Errorf("invalid --command-timeout %s: must be positive", *commandTimeoutFlag)
+	}
+	if *packageLockTimeoutFlag < 0 {
+		return fmt.Errorf("invalid --package-lock-timeout %s: must not be negative", *packageLockTimeoutFlag)
+	}
+	if isFlagSet("healthcheck-timeout") && isFlagSet("container-wait-timeout") && *healthcheckTimeoutFlag != *containerWaitTimeoutFlag {
+		return fmt.Errorf("--healthcheck-timeout and --container-wait-timeout set different timeouts, pass only one of them")
+	}
+	if *healthcheckTimeoutFlag <= 0 {
+		return fmt.Errorf("invalid --healthcheck-timeout %s: must be positive", *healthcheckTimeoutFlag)
+	}
+	if *healthcheckIntervalFlag <= 0 {
+		return fmt.Errorf("invalid --healthcheck-interval %s: must be positive", *healthcheckIntervalFlag)
+	}
+	if *containerWaitTimeoutFlag <= 0 || *containerWaitExtendFlag <= 0 {
+		return fmt.Errorf("invalid --container-wait-timeout %s or --container-wait-extend %s: must be positive", *containerWaitTimeoutFlag, *containerWaitExtendFlag)
+	}
+	for name, value := range map[string]string{"http-proxy": *httpProxyFlag, "https-proxy": *httpsProxyFlag} {
+		if value == "" {
+			continue
+		}
+		if u, err := url.Parse(value); err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			return fmt.Errorf("invalid --%s value %q: must be a URL like http://proxy.example.com:3128", name, value)
+		}
+	}
+	if *backupRetentionFlag < 0 {
+		return fmt.Errorf("invalid --backup-retention %d: must not be negative", *backupRetentionFlag)
+	}
+	if isFlagSet("backup-retention") && *backupFlag == "" {
+		return fmt.Errorf("--backup-retention needs --backup")
+	}
+	if *pullRetriesFlag < 0 {
+		return fmt.Errorf("invalid --pull-retries %d: must not be negative", *pullRetriesFlag)
+	}
+	if *tailFlag != "all" {
+		if n, err := strconv.Atoi(*tailFlag); err != nil || n < 0 {
+			return fmt.Errorf("invalid --tail value %q: must be a non-negative number or all", *tailFlag)
+		}
+	}
+	if _, ok := regenerateSets[*regenerateFlag]; *regenerateFlag != "" && !ok {
+		return fmt.Errorf("invalid --regenerate value %q: must be traefik or pangolin", *regenerateFlag)
+	}
+	if _, err := parseComponents(*componentsFlag); err != nil {
+		return fmt.Errorf("invalid --components value: %v", err)
+	}
+	if isFlagSet("output") && !*exportComposeFlag {
+		return fmt.Errorf("--output needs --export-compose")
+	}
+	if *enableCrowdsecFlag && *disableCrowdsecFlag {
+		return fmt.Errorf("--enable-crowdsec and --disable-crowdsec cannot be combined")
+	}
+	if (*enableCrowdsecFlag || *disableCrowdsecFlag) && isFlagSet("install-crowdsec") {
+		return fmt.Errorf("--install-crowdsec cannot be combined with --enable-crowdsec or --disable-crowdsec")
+	}
+	if *reportFormatFlag != "text" && *reportFormatFlag != "json" {
+		return fmt.Errorf("invalid --report-format value %q: must be text or json", *reportFormatFlag)
+	}
+
+	return nil
+}
+
+// resolveFlagAliases sets the flags that shorthand flags stand for, so the rest of the
+// installer only has to look at one of them
+func resolveFlagAliases() {
+	if *yesShortFlag {
+		flag.Set("yes", "true")
+	}
+	if isFlagSet("healthcheck-timeout") {
+		flag.Set("container-wait-timeout", healthcheckTimeoutFlag.String())
+	}
+	switch {
+	case *enableCrowdsecFlag:
+		flag.Set("install-crowdsec", "true")
+	case *disableCrowdsecFlag:
+		flag.Set("install-crowdsec", "false")
+	}
+}
+
+// repeatedFlag collects every value of a flag that can be passed more than once
+type repeatedFlag []string
+
+func (f *repeatedFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *repeatedFlag) Set(value string) error {
+	*f = append(*f, strings.TrimSpace(value))
+	return nil
+}
+
+// repeatedFlagVar defines a flag that collects every value it is passed
+func repeatedFlagVar(name string, usage string) *repeatedFlag {
+	values := &repeatedFlag{}
+	flag.Var(values, name, usage)
+	return values
+}
+
+// applyFlags copies the config-backed command line flags into config and validates them.
+// Flags passed explicitly win over values from an answer file, and flag defaults
+// fill in anything left unset.
+func applyFlags(config *Config) error {
+	if isFlagSet("metrics") {
+		config.EnableMetrics = *metricsFlag
+	}
+	if isFlagSet("metrics-port") || config.MetricsPort == 0 {
+		config.MetricsPort = *metricsPortFlag
+	}
+	if isFlagSet("metrics-allow") {
+		allowedIPs, err := parseIPList(*metricsAllowFlag)
+		if err != nil {
+			return fmt.Errorf("invalid --metrics-allow value: %v", err)
+		}
+		config.MetricsAllowedIPs = allowedIPs
+	}
+	if config.EnableMetrics {
+		if err := validateMetricsPort(config.MetricsPort); err != nil {
+			return err
+		}
+	}
+
+	if isFlagSet("no-bind-web-ports") {
+		config.ExternalProxy = *noBindWebPortsFlag
+	}
+	if isFlagSet("bind-address") {
+		config.BindAddress = *bindAddressFlag
+	}
+	if config.BindAddress != "" {
+		if err := validateBindAddress(config.BindAddress); err != nil {
+			return fmt.Errorf("invalid bind address: %v", err)
+		}
+	}
+
+	if isFlagSet("db-backend") {
+		config.DbBackend = *dbBackendFlag
+	}
+	if isFlagSet("postgres-host") {
+		config.DbBackend = dbBackendPostgres
+		config.PostgresHost = *postgresHostFlag
+	}
+	if isFlagSet("postgres-port") || config.PostgresPort == 0 {
+		config.PostgresPort = *postgresPortFlag
+	}
+	if isFlagSet("postgres-user") {
+		config.PostgresUser = *postgresUserFlag
+	}
+	if isFlagSet("postgres-db") || config.PostgresDB == "" {
+		config.PostgresDB = *postgresDBFlag
+	}
+	switch config.DbBackend {
+	case "":
+		config.DbBackend = dbBackendSQLite
+	case dbBackendSQLite:
+	case dbBackendPostgres:
+		if config.PostgresPass == "" {
+			config.PostgresPass = os.Getenv(postgresPassEnv)
+		}
+		if err := validatePostgresConfig(*config); err != nil {
+			return fmt.Errorf("%v: pass --postgres-host and --postgres-user", err)
+		}
+	default:
+		return fmt.Errorf("invalid database backend %q: must be %s or %s", config.DbBackend, dbBackendSQLite, dbBackendPostgres)
+	}
+
+	if isFlagSet("timezone") {
+		if err := validateTimezone(*timezoneFlag); err != nil {
+			return fmt.Errorf("invalid --timezone value: %v", err)
+		}
+		config.Timezone = *timezoneFlag
+	}
+	if config.Timezone == "" {
+		config.Timezone = detectHostTimezone()
+	} else if err := validateTimezone(config.Timezone); err != nil {
+		return fmt.Errorf("invalid time zone: %v", err)
+	}
+
+	if isFlagSet("site") {
+		config.SiteDomains = *siteFlag
+	}
+	if err := validateSiteDomains(config.SiteDomains, config.BaseDomain); err != nil {
+		return err
+	}
+	if len(config.SiteDomains) > 0 && config.AcmeChallenge == acmeDNSChallenge {
+		logInfo("The wildcard certificates of the additional domains are requested from %s too, it has to manage their DNS zones.", config.DNSProvider)
+	}
+
+	if isFlagSet("registry") {
+		config.RegistryPrefix = *registryFlag
+	}
+	if config.RegistryPrefix != "" {
+		prefix, err := normalizeRegistryPrefix(config.RegistryPrefix)
+		if err != nil {
+			return fmt.Errorf("invalid registry: %v", err)
+		}
+		config.RegistryPrefix = prefix
+	}
+
+	if isFlagSet("image-lock") {
+		digests, err := loadImageLock(*imageLockFlag)
+		if err != nil {
+			return err
+		}
+		config.ImageDigests = digests
+	}
+
+	if isFlagSet("dns-provider") {
+		config.AcmeChallenge = acmeDNSChallenge
+		config.DNSProvider = *dnsProviderFlag
+	}
+	switch config.AcmeChallenge {
+	case "":
+		config.AcmeChallenge = acmeHTTPChallenge
+	case acmeHTTPChallenge:
+	case acmeDNSChallenge:
+		provider, ok := dnsProviders[config.DNSProvider]
+		if !ok {
+			return fmt.Errorf("invalid DNS provider %q for the DNS-01 challenge: must be one of %s", config.DNSProvider, strings.Join(dnsProviderNames(), ", "))
+		}
+		if isFlagSet("dns-api-token") || config.DNSAPIToken == "" {
+			config.DNSAPIToken = dnsProviderToken(provider)
+		}
+		if config.DNSAPIToken == "" {
+			return fmt.Errorf("no credentials for %s: set %s or pass --dns-api-token", config.DNSProvider, provider.TokenEnv)
+		}
+	default:
+		return fmt.Errorf("invalid ACME challenge %q: must be %s or %s", config.AcmeChallenge, acmeHTTPChallenge, acmeDNSChallenge)
+	}
+
+	if isFlagSet("acme-staging") && isFlagSet("acme-ca-server") {
+		return fmt.Errorf("--acme-staging cannot be combined with --acme-ca-server")
+	}
+	if *acmeStagingFlag {
+		config.AcmeCaServer = letsEncryptStaging
+	}
+	if isFlagSet("acme-ca-server") {
+		config.AcmeCaServer = *acmeCaServerFlag
+	}
+	if config.AcmeCaServer != "" {
+		if u, err := url.Parse(config.AcmeCaServer); err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("invalid ACME CA server %q: must be an https:// directory URL", config.AcmeCaServer)
+		}
+	}
+	if config.AcmeCaServer == letsEncryptStaging {
+		logWarn("Warning: using the Let's Encrypt staging CA, browsers will not trust its certificates. Switch back to production with --reconcile --acme-ca-server %s", letsEncryptProduction)
+	}
+
+	// Let's Encrypt cannot reach Traefik on port 80 for the HTTP-01 challenge
+	if config.ExternalProxy && config.AcmeChallenge != acmeDNSChallenge {
+		return fmt.Errorf("an external reverse proxy owns port 80, so the certificates need the DNS-01 challenge: pass --dns-provider")
+	}
+
+	if isFlagSet("components") {
+		selected, _ := parseComponents(*componentsFlag)
+		applyComponents(config, selected)
+		if config.EnableEmail && (config.EmailSMTPHost == "" || config.EmailNoReply == "") {
+			return fmt.Errorf("--components enables email but email_smtp_host and email_no_reply are not set")
+		}
+	}
+
+	if *swarmFlag && config.InstallGerbil {
+		return fmt.Errorf("--swarm cannot be combined with Gerbil, answer no to the Gerbil question to deploy to a swarm")
+	}
+
+	for _, override := range []struct {
+		name  string
+		value string
+		args  *[]string
+	}{
+		{"app-entrypoint", *appEntrypointFlag, &config.AppEntrypoint},
+		{"app-command", *appCommandFlag, &config.AppCommand},
+	} {
+		if !isFlagSet(override.name) {
+			continue
+		}
+		args, err := splitArgs(override.value)
+		if err != nil {
+			return fmt.Errorf("invalid --%s value: %v", override.name, err)
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("invalid --%s value: must not be empty", override.name)
+		}
+		logWarn("Warning: --%s overrides the image default and is meant for advanced debugging only.", override.name)
+		*override.args = args
+	}
+
+	var err error
+	if isFlagSet("log-max-size") || config.LogMaxSizeMB == 0 {
+		if config.LogMaxSizeMB, err = parseSizeMB(*logMaxSizeFlag); err != nil {
+			return fmt.Errorf("invalid --log-max-size value: %v", err)
+		}
+	}
+	if isFlagSet("log-max-age") || config.LogMaxAgeDays == 0 {
+		if config.LogMaxAgeDays, err = parseDays(*logMaxAgeFlag); err != nil {
+			return fmt.Errorf("invalid --log-max-age value: %v", err)
+		}
+	}
+	if isFlagSet("log-max-files") || config.LogMaxFiles == 0 {
+		config.LogMaxFiles = *logMaxFilesFlag
+	}
+	if config.LogMaxSizeMB < 1 || config.LogMaxAgeDays < 1 || config.LogMaxFiles < 1 {
+		return fmt.Errorf("log rotation size, age and file count must all be at least 1")
+	}
+
+	return nil
+}
+
+// isFlagSet reports whether the named flag was passed on the command line
+func isFlagSet(name string) bool {
+	set := false
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// lockableImages maps the compose services to the repositories an image lock pins. The
+// repositories are kept without the registry, digests are the same on every mirror.
+var lockableImages = map[string]string{
+	"pangolin": "fosrl/pangolin",
+	"gerbil":   "fosrl/gerbil",
+	"traefik":  "traefik",
+	"crowdsec": "crowdsecurity/crowdsec",
+}
+
+var imageDigestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// imageLock is the file read by --image-lock and written by --write-image-lock
+type imageLock struct {
+	Images map[string]string `yaml:"images"`
+}
+
+// Image returns the reference of a stack image, pinned to its digest when the image lock has one
+func (c Config) Image(repository string, tag string) string {
+	image := c.ImageRegistry() + "/" + repository + ":" + tag
+	if digest, ok := c.ImageDigests[repository]; ok {
+		image += "@" + digest
+	}
+	return image
+}
+
+// loadImageLock reads the image digests of an image lock file
+func loadImageLock(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the image lock: %v", err)
+	}
+
+	var lock imageLock
+	if err := yaml.Unmarshal(data, &lock); err != nil {
+		return nil, fmt.Errorf("error parsing the image lock %s: %v", path, err)
+	}
+	if len(lock.Images) == 0 {
+		return nil, fmt.Errorf("the image lock %s pins no images", path)
+	}
+
+	known := make(map[string]bool)
+	for _, repository := range lockableImages {
+		known[repository] = true
+	}
+	for repository, digest := range lock.Images {
+		if !known[repository] {
+			return nil, fmt.Errorf("the image lock %s pins the unknown image %q", path, repository)
+		}
+		if !imageDigestPattern.MatchString(digest) {
+			return nil, fmt.Errorf("the image lock %s has an invalid digest for %s: %q", path, repository, digest)
+		}
+	}
+	return lock.Images, nil
+}
+
+// installedImageDigests returns the digests the images of the compose services are pinned to
+func installedImageDigests(services map[string]interface{}) map[string]string {
+	digests := make(map[string]string)
+	for service, repository := range lockableImages {
+		settings, _ := services[service].(map[string]interface{})
+		image, _ := settings["image"].(string)
+		if _, digest, found := strings.Cut(image, "@"); found {
+			digests[repository] = digest
+		}
+	}
+	if len(digests) == 0 {
+		return nil
+	}
+	return digests
+}
+
+// writeImageLock records the digests of the pulled images of the compose file, so a later
+// install with --image-lock deploys exactly the same images
+func writeImageLock(path string, containerType SupportedContainer) error {
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+	images, err := composeImages(composeFile)
+	if err != nil {
+		return err
+	}
+
+	lock := imageLock{Images: make(map[string]string)}
+	for service, image := range images {
+		repository, ok := lockableImages[service]
+		if !ok {
+			continue
+		}
+		digest, err := pulledImageDigest(containerType, image, repository)
+		if err != nil {
+			return err
+		}
+		lock.Images[repository] = digest
+	}
+
+	data, err := yaml.Marshal(&lock)
+	if err != nil {
+		return fmt.Errorf("error marshaling the image lock: %v", err)
+	}
+	header := "# Image digests recorded by the Pangolin installer, install them again with --image-lock " + path + "\n"
+	if err := os.WriteFile(path, append([]byte(header), data...), 0644); err != nil {
+		return fmt.Errorf("error writing the image lock: %v", err)
+	}
+
+	repositories := make([]string, 0, len(lock.Images))
+	for repository := range lock.Images {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+	logInfo("Recorded the image digests in %s:", path)
+	for _, repository := range repositories {
+		logInfo("  %s: %s", repository, lock.Images[repository])
+	}
+	return nil
+}
+
+// pulledImageDigest returns the registry digest of a local image. An image can carry the
+// digests of several registries, so the one of repository is preferred.
+func pulledImageDigest(containerType SupportedContainer, image string, repository string) (string, error) {
+	out, err := exec.Command(string(containerType), "image", "inspect", "--format", "{{json .RepoDigests}}", image).Output()
+	if err != nil {
+		return "", fmt.Errorf("could not inspect the image %s: %v", image, err)
+	}
+
+	var repoDigests []string
+	if err := json.Unmarshal(out, &repoDigests); err != nil {
+		return "", fmt.Errorf("could not read the digests of the image %s: %v", image, err)
+	}
+
+	var digest string
+	for _, repoDigest := range repoDigests {
+		name, value, found := strings.Cut(repoDigest, "@")
+		if !found {
+			continue
+		}
+		if name == repository || strings.HasSuffix(name, "/"+repository) {
+			return value, nil
+		}
+		if digest == "" {
+			digest = value
+		}
+	}
+	if digest == "" {
+		return "", fmt.Errorf("the image %s has no registry digest", image)
+	}
+	return digest, nil
+}
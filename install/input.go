@@ -2,20 +2,48 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 
 	"golang.org/x/term"
 )
 
+// stdinClosed is set once a prompt hits the end of the input, so validation loops can stop re-asking
+var stdinClosed bool
+
+// stdinReader is the one reader of stdin every prompt shares. A second reader would swallow
+// the piped answers the first one has already buffered.
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// stdinLock is held while a line of stdin is read, so the interrupt handler never reads at
+// the same time as a prompt
+var stdinLock sync.Mutex
+
+// readLine reads one line of the answers
+func readLine(reader *bufio.Reader) (string, error) {
+	stdinLock.Lock()
+	defer stdinLock.Unlock()
+	return reader.ReadString('\n')
+}
+
 func readString(reader *bufio.Reader, prompt string, defaultValue string) string {
+	if *yesFlag {
+		return acceptDefault(prompt, defaultValue)
+	}
 	if defaultValue != "" {
 		fmt.Printf("%s (default: %s): ", prompt, defaultValue)
 	} else {
 		fmt.Print(prompt + ": ")
 	}
-	input, _ := reader.ReadString('\n')
+	input, err := readLine(reader)
+	if err == io.EOF {
+		stdinClosed = true
+	}
 	input = strings.TrimSpace(input)
 	if input == "" {
 		return defaultValue
@@ -23,30 +51,121 @@ func readString(reader *bufio.Reader, prompt string, defaultValue string) string
 	return input
 }
 
+// readValidatedString prompts until validate accepts the input, printing the reason for each rejection
+func readValidatedString(reader *bufio.Reader, prompt string, defaultValue string, validate func(string) (bool, string)) string {
+	for {
+		input := readString(reader, prompt, defaultValue)
+		ok, reason := validate(input)
+		if ok {
+			return input
+		}
+		fmt.Printf("Invalid value: %s\n", reason)
+		if stdinClosed {
+			logError("Error: no more input available")
+			exit(1)
+		}
+	}
+}
+
 func readStringNoDefault(reader *bufio.Reader, prompt string) string {
+	if *yesFlag {
+		return acceptDefault(prompt, "")
+	}
 	fmt.Print(prompt + ": ")
-	input, _ := reader.ReadString('\n')
+	input, _ := readLine(reader)
 	return strings.TrimSpace(input)
 }
 
+// readPassword prompts without echo on a terminal and asks a second time to catch typos.
+// With --show-password, or when stdin is not a terminal, the input is read like any other answer.
 func readPassword(prompt string, reader *bufio.Reader) string {
-	if term.IsTerminal(int(syscall.Stdin)) {
-		fmt.Print(prompt + ": ")
-		// Read password without echo if we're in a terminal
-		password, err := term.ReadPassword(int(syscall.Stdin))
-		fmt.Println() // Add a newline since ReadPassword doesn't add one
-		if err != nil {
-			return ""
+	if *yesFlag {
+		return acceptDefault(prompt, "")
+	}
+	if *showPasswordFlag || !isStdinTerminal() {
+		return readString(reader, prompt, "")
+	}
+
+	for {
+		password := readHiddenAnswer(prompt)
+		if password == "" {
+			continue
 		}
-		input := strings.TrimSpace(string(password))
-		if input == "" {
-			return readPassword(prompt, reader)
+		if readHiddenAnswer("Confirm "+strings.ToLower(prompt[:1])+prompt[1:]) == password {
+			return password
 		}
-		return input
-	} else {
-		// Fallback to reading from stdin if not in a terminal
-		return readString(reader, prompt, "")
+		logWarn("The entries do not match, please try again.")
+	}
+}
+
+// readHiddenAnswer reads a hidden line and aborts the installer when the terminal cannot be
+// read, e.g. on Ctrl-D, instead of prompting again forever
+func readHiddenAnswer(prompt string) string {
+	answer, err := readHiddenLine(prompt)
+	if err != nil {
+		logError("Error: could not read %q from the terminal: %v", prompt, err)
+		exit(1)
+	}
+	return answer
+}
+
+// readHiddenLine reads one line from the terminal without echo. Surrounding space is trimmed,
+// including the carriage return pasted input often carries.
+func readHiddenLine(prompt string) (string, error) {
+	fmt.Print(prompt + ": ")
+
+	// Let an interrupt turn echo back on
+	fd := int(os.Stdin.Fd())
+	if state, err := term.GetState(fd); err == nil {
+		interruptState.Lock()
+		interruptState.terminal = state
+		interruptState.Unlock()
+		defer func() {
+			interruptState.Lock()
+			interruptState.terminal = nil
+			interruptState.Unlock()
+		}()
+	}
+
+	password, err := term.ReadPassword(fd)
+	fmt.Println() // Add a newline since ReadPassword doesn't add one
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(password)), nil
+}
+
+// acceptDefault answers a prompt with its default for --yes, printing the answer so the
+// output shows what was chosen. A prompt without a default cannot be answered and is fatal.
+func acceptDefault(prompt string, defaultValue string) string {
+	if defaultValue == "" {
+		logError("Error: --yes is set but %q has no default, pass the answer with a flag or --config-file", prompt)
+		exit(1)
 	}
+	fmt.Printf("%s: %s\n", prompt, defaultValue)
+	return defaultValue
+}
+
+// readBoolOnInterrupt asks a yes/no question from the interrupt handler. While a prompt of the
+// installer is waiting for its answer, stdin belongs to that prompt and the default is taken,
+// as it is with --yes.
+func readBoolOnInterrupt(reader *bufio.Reader, prompt string, defaultValue bool) bool {
+	if *yesFlag {
+		logInfo("%s %s", prompt, yesNo(defaultValue))
+		return defaultValue
+	}
+	if !stdinLock.TryLock() {
+		logInfo("%s %s", prompt, yesNo(defaultValue))
+		return defaultValue
+	}
+	defer stdinLock.Unlock()
+
+	fmt.Printf("%s (yes/no) (default: %s): ", prompt, yesNo(defaultValue))
+	input, _ := reader.ReadString('\n')
+	if input = strings.TrimSpace(input); input == "" {
+		return defaultValue
+	}
+	return strings.ToLower(input) == "yes"
 }
 
 func readBool(reader *bufio.Reader, prompt string, defaultValue bool) bool {
@@ -58,6 +177,28 @@ func readBool(reader *bufio.Reader, prompt string, defaultValue bool) bool {
 	return strings.ToLower(input) == "yes"
 }
 
+// confirm answers a yes/no question with the named flag when it was passed and prompts otherwise.
+// With --yes the default is taken, and with --quiet a missing flag is fatal.
+func confirm(reader *bufio.Reader, flagName string, prompt string, defaultValue bool) bool {
+	if isFlagSet(flagName) {
+		return flag.Lookup(flagName).Value.(flag.Getter).Get().(bool)
+	}
+	if *yesFlag {
+		return readBool(reader, prompt, defaultValue)
+	}
+	failQuiet(flagName, prompt)
+	return readBool(reader, prompt, defaultValue)
+}
+
+// failQuiet exits in --quiet mode, naming the flag that would have answered the prompt
+func failQuiet(flagName string, prompt string) {
+	if !*quietFlag {
+		return
+	}
+	logError("Error: --quiet is set but --%s was not given to answer %q", flagName, prompt)
+	exit(1)
+}
+
 func readBoolNoDefault(reader *bufio.Reader, prompt string) bool {
 	input := readStringNoDefault(reader, prompt+" (yes/no)")
 	return strings.ToLower(input) == "yes"
@@ -72,3 +213,19 @@ func readInt(reader *bufio.Reader, prompt string, defaultValue int) int {
 	fmt.Sscanf(input, "%d", &value)
 	return value
 }
+
+// readIntInRange prompts until the input is an integer between min and max, inclusive
+func readIntInRange(reader *bufio.Reader, prompt string, defaultValue int, min int, max int) int {
+	for {
+		input := readString(reader, prompt, fmt.Sprintf("%d", defaultValue))
+		value, err := strconv.Atoi(input)
+		if err == nil && value >= min && value <= max {
+			return value
+		}
+		fmt.Printf("Invalid value: enter a number between %d and %d\n", min, max)
+		if stdinClosed {
+			logError("Error: no more input available")
+			exit(1)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+// failingReader fails the test when a prompt reads from it
+type failingReader struct {
+	t *testing.T
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	r.t.Error("the prompt read from stdin")
+	return 0, nil
+}
+
+func TestReadIntInRange(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  int
+	}{
+		{"min", "1\n", 1},
+		{"max", "65535\n", 65535},
+		{"default", "\n", 587},
+		{"below min then valid", "0\n25\n", 25},
+		{"above max then valid", "65536\n465\n", 465},
+		{"non-numeric then valid", "smtp\n2525\n", 2525},
+		{"re-prompts until valid", "-1\n70000\nabc\n587\n", 587},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := bufio.NewReader(strings.NewReader(tt.input))
+			if got := readIntInRange(reader, "SMTP port", 587, 1, 65535); got != tt.want {
+				t.Errorf("readIntInRange(%q) = %d, want %d", tt.input, got, tt.want)
+			}
+			if rest, _ := reader.ReadString('\n'); rest != "" {
+				t.Errorf("readIntInRange(%q) left %q unread", tt.input, rest)
+			}
+		})
+	}
+}
+
+func TestReadBoolYesTakesDefault(t *testing.T) {
+	*yesFlag = true
+	t.Cleanup(func() { *yesFlag = false })
+
+	reader := bufio.NewReader(failingReader{t})
+	if !readBool(reader, "Install Gerbil?", true) {
+		t.Error("readBool with --yes = false, want the default true")
+	}
+	if readBool(reader, "Enable email?", false) {
+		t.Error("readBool with --yes = true, want the default false")
+	}
+}
+
+func TestReadBoolOnInterruptYesTakesDefault(t *testing.T) {
+	*yesFlag = true
+	t.Cleanup(func() { *yesFlag = false })
+
+	reader := bufio.NewReader(failingReader{t})
+	if !readBoolOnInterrupt(reader, "Stop the containers this install started?", true) {
+		t.Error("readBoolOnInterrupt with --yes = false, want the default true")
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// installStateFile records the completed steps of a fresh install until it finishes
+const installStateFile = "config/.install-state.json"
+
+// The major steps of a fresh install, in the order they complete
+const (
+	stepConfigWritten     = "config written"
+	stepDockerInstalled   = "docker installed"
+	stepImagesPulled      = "images pulled"
+	stepContainersStarted = "containers started"
+)
+
+// installState is the content of installStateFile
+type installState struct {
+	Steps     []string `json:"completed_steps"`
+	UpdatedAt string   `json:"updated_at"`
+	// Created are the files and directories the install created, the only ones a rollback removes
+	Created []string `json:"created_paths,omitempty"`
+}
+
+// createdPaths collects what this run created until the next markInstallStep records it
+var createdPaths []string
+
+// trackCreated remembers that this run created path
+func trackCreated(path string) {
+	if !slices.Contains(createdPaths, path) {
+		createdPaths = append(createdPaths, path)
+	}
+}
+
+// installCreatedPaths returns everything the install created, including the paths an
+// interrupted run recorded before this one resumed it, in the order they were created
+func installCreatedPaths() []string {
+	var paths []string
+	if state, err := readInstallState(); err == nil && state != nil {
+		paths = append(paths, state.Created...)
+	}
+	for _, path := range createdPaths {
+		if !slices.Contains(paths, path) {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// readInstallState returns the state of an interrupted install, or nil when there is none
+func readInstallState() (*installState, error) {
+	data, err := os.ReadFile(installStateFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", installStateFile, err)
+	}
+
+	var state installState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", installStateFile, err)
+	}
+	return &state, nil
+}
+
+// done reports whether step completed, a nil state has no completed steps
+func (s *installState) done(step string) bool {
+	return s != nil && slices.Contains(s.Steps, step)
+}
+
+// lastStep returns the step that completed last
+func (s *installState) lastStep() string {
+	if s == nil || len(s.Steps) == 0 {
+		return "nothing"
+	}
+	return s.Steps[len(s.Steps)-1]
+}
+
+// markInstallStep records that step completed along with the paths created so far. Failing to record it only costs the resume,
+// so it is a warning.
+func markInstallStep(step string) {
+	state, err := readInstallState()
+	if err != nil || state == nil {
+		state = &installState{}
+	}
+	pending := false
+	for _, path := range createdPaths {
+		if !slices.Contains(state.Created, path) {
+			state.Created = append(state.Created, path)
+			pending = true
+		}
+	}
+	if state.done(step) && !pending {
+		return
+	}
+	if !state.done(step) {
+		state.Steps = append(state.Steps, step)
+	}
+	state.UpdatedAt = time.Now().UTC().Format(time.RFC3339)
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err == nil {
+		err = os.WriteFile(installStateFile, append(data, '\n'), 0600)
+	}
+	if err != nil {
+		logWarn("Warning: could not record the install progress in %s: %v", installStateFile, err)
+	}
+}
+
+// clearInstallState removes the state file once the install is complete
+func clearInstallState() {
+	if err := os.Remove(installStateFile); err != nil && !os.IsNotExist(err) {
+		logWarn("Warning: could not remove %s: %v", installStateFile, err)
+	}
+}
+
+// offerResume asks whether to continue an install that was interrupted after it wrote the
+// configuration and returns its state with the installed configuration. It returns a nil
+// state when there is nothing to resume or the user declines.
+func offerResume(reader *bufio.Reader) (*installState, Config) {
+	state, err := readInstallState()
+	if err != nil {
+		logWarn("Warning: ignoring the interrupted install: %v", err)
+		return nil, Config{}
+	}
+	if state == nil {
+		return nil, Config{}
+	}
+
+	logInfo("A previous install was interrupted, the last completed step was: %s.", state.lastStep())
+	if !confirm(reader, "resume", "Resume the interrupted install?", true) {
+		clearInstallState()
+		return nil, Config{}
+	}
+
+	config, err := loadInstalledConfig()
+	if err == nil {
+		err = applyFlags(&config)
+	}
+	if err != nil {
+		logError("Error: could not resume from the written configuration: %v", err)
+		exit(1)
+	}
+	loadVersions(&config)
+	recordResultConfig(config)
+	return state, config
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"time"
+)
+
+// coreServices returns the services the stack needs to be considered up, based on the compose file
+func coreServices(composePath string) ([]string, error) {
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return nil, err
+	}
+
+	core := []string{"pangolin"}
+	if _, ok := services["gerbil"]; ok {
+		core = append(core, "gerbil")
+	}
+	return append(core, "traefik"), nil
+}
+
+// waitForCoreServices waits for each core service and reports which ones came back.
+// It returns an error naming the services that did not start.
+func waitForCoreServices(containerType SupportedContainer) error {
+	services, err := coreServices(*composeFileFlag)
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, service := range services {
+		if err := waitPatiently(service, containerType, waitForContainerHealthy); err != nil {
+			logInfo("  %s: not ready", service)
+			failed = append(failed, service)
+			continue
+		}
+		logInfo("  %s: ready", service)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("services did not come back: %v", failed)
+	}
+	return nil
+}
+
+// restartStack restarts the whole stack and waits for the core services
+func restartStack() error {
+	if _, err := composeFilePath(); err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	if err := restartContainers(containerType); err != nil {
+		return err
+	}
+
+	logInfo("Waiting for the core services...")
+	return waitForCoreServices(containerType)
+}
+
+// composeImages returns the image of every service in the compose file, keyed by service name
+func composeImages(composePath string) (map[string]string, error) {
+	services, err := readComposeServices(composePath)
+	if err != nil {
+		return nil, err
+	}
+
+	images := make(map[string]string)
+	for name, service := range services {
+		serviceMap, ok := service.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if image, ok := serviceMap["image"].(string); ok {
+			images[name] = image
+		}
+	}
+	return images, nil
+}
+
+// imageDigests returns the repo digest (or the image ID if it has none) of each local image
+func imageDigests(containerType SupportedContainer, images map[string]string) map[string]string {
+	digests := make(map[string]string)
+	for service, image := range images {
+		out, err := exec.Command(string(containerType), "image", "inspect", "--format",
+			"{{if .RepoDigests}}{{index .RepoDigests 0}}{{else}}{{.Id}}{{end}}", image).Output()
+		if err != nil {
+			digests[service] = "not present"
+			continue
+		}
+		digests[service] = strings.TrimSpace(string(out))
+	}
+	return digests
+}
+
+// updateStack pulls newer images, recreates the containers and waits for the core services.
+// The current compose file is kept with a .bak suffix for rolling back.
+func updateStack() error {
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	if err := copyFile(composeFile, composeFile+".bak"); err != nil {
+		return fmt.Errorf("failed to back up %s: %v", composeFile, err)
+	}
+	logInfo("Backed up %s to %s.bak", composeFile, composeFile)
+
+	images, err := composeImages(composeFile)
+	if err != nil {
+		return err
+	}
+	before := imageDigests(containerType, images)
+
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	after := imageDigests(containerType, images)
+
+	services := make([]string, 0, len(images))
+	for service := range images {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+
+	logInfo("\nImage digests:")
+	for _, service := range services {
+		if before[service] == after[service] {
+			logInfo("  %s: %s (unchanged)", service, after[service])
+			continue
+		}
+		logInfo("  %s: %s -> %s", service, before[service], after[service])
+	}
+	logInfo("")
+
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+
+	logInfo("Waiting for the core services...")
+	return waitForCoreServices(containerType)
+}
+
+// reinstallContainers pulls the images of the current compose file again and recreates the
+// containers from them, without touching the configuration or the versions
+func reinstallContainers() error {
+	if _, err := composeFilePath(); err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	if err := pullContainers(containerType); err != nil {
+		return err
+	}
+	if err := startContainers(containerType); err != nil {
+		return err
+	}
+
+	logInfo("Waiting for the core services...")
+	return waitForCoreServices(containerType)
+}
+
+// containerStatus returns the state, health and uptime of a container
+func containerStatus(name string, containerType SupportedContainer) (state, health, uptime string) {
+	out, err := exec.Command(string(containerType), "container", "inspect", "-f",
+		"{{.State.Status}}|{{if .State.Health}}{{.State.Health.Status}}{{end}}|{{.State.StartedAt}}", name).Output()
+	if err != nil {
+		return "missing", "-", "-"
+	}
+
+	parts := strings.SplitN(strings.TrimSpace(string(out)), "|", 3)
+	if len(parts) != 3 {
+		return "unknown", "-", "-"
+	}
+	state, health, uptime = parts[0], parts[1], "-"
+	if health == "" {
+		health = "none"
+	}
+	if started, err := time.Parse(time.RFC3339Nano, parts[2]); err == nil && state == "running" {
+		uptime = time.Since(started).Round(time.Second).String()
+	}
+	return state, health, uptime
+}
+
+// stackStatus fills the report with the state of every compose service and fails
+// if a core service is not running
+func stackStatus(report *Report) error {
+	services, err := readComposeServices(*composeFileFlag)
+	if err != nil {
+		return fmt.Errorf("%v, run this from the installation directory", err)
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if override := composeOverridePath(*composeFileFlag); override != "" {
+		report.AddCheck("compose override", true, override+" is applied on top of "+*composeFileFlag)
+	}
+
+	report.Columns = []string{"service", "state", "health", "uptime"}
+	var down []string
+	for _, name := range names {
+		var state, health, uptime string
+		if *swarmFlag && containerType == Docker {
+			state, health, uptime = "stopped", "-", "-"
+			if isSwarmServiceRunning(name) {
+				state = "running"
+			}
+		} else {
+			state, health, uptime = containerStatus(name, containerType)
+		}
+		report.AddRow(name, state, health, uptime)
+
+		if (name == "pangolin" || name == "traefik") && state != "running" {
+			down = append(down, name)
+		}
+	}
+
+	if len(down) > 0 {
+		report.Message = "The stack is DOWN"
+		return fmt.Errorf("core services not running: %s", strings.Join(down, ", "))
+	}
+	report.Message = "The stack is up"
+	return nil
+}
+
+// listServices fills the report with the image and published ports of every service in the
+// compose file. It only reads the file, so it works without Docker or Podman installed.
+func listServices(report *Report) error {
+	services, err := readComposeServices(*composeFileFlag)
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	report.Columns = []string{"service", "image", "ports"}
+	for _, name := range names {
+		serviceMap, _ := services[name].(map[string]interface{})
+		image, _ := serviceMap["image"].(string)
+		ports := composePorts(serviceMap["ports"])
+		if len(ports) == 0 {
+			ports = []string{"-"}
+		}
+		if image == "" {
+			image = "-"
+		}
+		report.AddRow(name, image, strings.Join(ports, ","))
+	}
+	return nil
+}
+
+// composePorts renders a compose ports list, accepting both the short "80:80" and the
+// long published/target syntax
+func composePorts(value interface{}) []string {
+	items, _ := value.([]interface{})
+	var ports []string
+	for _, item := range items {
+		switch port := item.(type) {
+		case map[string]interface{}:
+			mapping := fmt.Sprintf("%v:%v", port["published"], port["target"])
+			if protocol, ok := port["protocol"].(string); ok && protocol != "tcp" {
+				mapping += "/" + protocol
+			}
+			ports = append(ports, mapping)
+		default:
+			ports = append(ports, fmt.Sprint(port))
+		}
+	}
+	return ports
+}
+
+// streamServiceLogs follows the logs of one compose service until interrupted, starting
+// with the last tail lines ("all" for the whole history)
+func streamServiceLogs(service string, tail string) error {
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+	services, err := readComposeServices(composeFile)
+	if err != nil {
+		return err
+	}
+	if _, ok := services[service]; !ok {
+		names := make([]string, 0, len(services))
+		for name := range services {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("service %q not found in %s, available services: %s", service, composeFile, strings.Join(names, ", "))
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	// Following has no natural end, so the command timeout does not apply
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if containerType == Docker && *swarmFlag {
+		cmd = newCommand(ctx, "docker", "service", "logs", "--follow", "--tail", tail, swarmServiceName(service))
+	} else if cmd, err = composeCommand(ctx, containerType, append(composeFileArgs(composeFile), "logs", "--follow", "--tail", tail, service)...); err != nil {
+		return err
+	}
+
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	return runCommandContext(ctx, cmd)
+}
+
+// verifyDashboardReachable requests the dashboard over HTTPS and returns an error unless it
+// answers with a success or redirect status. An invalid certificate is tolerated with a
+// warning because Let's Encrypt may still be issuing it.
+func verifyDashboardReachable(config Config) error {
+	dashboardURL := "https://" + config.DashboardDomain
+	client := &http.Client{Timeout: 15 * time.Second}
+
+	resp, err := client.Get(dashboardURL)
+	var certErr *tls.CertificateVerificationError
+	if errors.As(err, &certErr) {
+		logWarn("Warning: the certificate of %s is not trusted yet (%v), it may still be provisioning.", config.DashboardDomain, certErr.Err)
+		client.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+		resp, err = client.Get(dashboardURL)
+	}
+	if err != nil {
+		return fmt.Errorf("could not reach %s: %v", dashboardURL, err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("%s answered with %s", dashboardURL, resp.Status)
+	}
+	logInfo("The dashboard answered with %s.", resp.Status)
+	return nil
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logRecord is a single line of --json-logs output
+type logRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Step    string `json:"step,omitempty"`
+}
+
+// logState is where the status output goes and which installer step is running
+var logState = struct {
+	sync.Mutex
+	out  io.Writer
+	file *os.File
+	step string
+}{out: os.Stdout}
+
+// setupLogging opens the --log-file so all status output is also written there. The
+// status output goes to stderr when stdout carries the exported compose file or config.
+func setupLogging() error {
+	console := io.Writer(os.Stdout)
+	if *printConfigFlag || (*exportComposeFlag && *outputFlag == "") {
+		console = os.Stderr
+	}
+	logState.out = console
+	if *logFileFlag == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(*logFileFlag, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %v", err)
+	}
+	logState.file = file
+	logState.out = io.MultiWriter(console, file)
+	return nil
+}
+
+// logStep starts a new installer step, printed as a section header
+func logStep(name string) {
+	logState.Lock()
+	logState.step = name
+	logState.Unlock()
+
+	if *jsonLogsFlag {
+		writeLog("info", name)
+		return
+	}
+	writeLog("info", "\n"+styled(styleBold, "=== "+name+" ==="))
+}
+
+// logInfo prints a status message
+func logInfo(format string, args ...interface{}) {
+	writeLog("info", fmt.Sprintf(format, args...))
+}
+
+// logWarn prints a warning
+func logWarn(format string, args ...interface{}) {
+	writeLog("warn", fmt.Sprintf(format, args...))
+}
+
+// logError prints an error
+func logError(format string, args ...interface{}) {
+	writeLog("error", fmt.Sprintf(format, args...))
+}
+
+// writeLog writes message as text, or as a JSON record with --json-logs
+func writeLog(level, message string) {
+	recordResultLog(level, message)
+
+	logState.Lock()
+	defer logState.Unlock()
+
+	if !*jsonLogsFlag {
+		switch level {
+		case "warn":
+			message = styled(styleYellow, message)
+		case "error":
+			message = styled(styleRed, message)
+		}
+		fmt.Fprintln(logState.out, message)
+		return
+	}
+
+	// The level field replaces the prefixes of the human readable output
+	message = strings.TrimSpace(message)
+	message = strings.TrimPrefix(message, "Error: ")
+	message = strings.TrimPrefix(message, "Warning: ")
+	if message == "" {
+		return
+	}
+
+	record, err := json.Marshal(logRecord{
+		Time:    time.Now().UTC().Format(time.RFC3339),
+		Level:   level,
+		Message: message,
+		Step:    logState.step,
+	})
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(logState.out, string(record))
+}
+
+// commandOutput returns the stdout and stderr for a child command. Without --log-file and
+// --json-logs the terminal is passed through so tools keep their interactive output.
+func commandOutput() (io.Writer, io.Writer) {
+	if *logFileFlag == "" && !*jsonLogsFlag {
+		return os.Stdout, os.Stderr
+	}
+	writer := &logLineWriter{}
+	return writer, writer
+}
+
+// logLineWriter turns child command output into log lines
+type logLineWriter struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !*jsonLogsFlag {
+		logState.Lock()
+		defer logState.Unlock()
+		return logState.out.Write(p)
+	}
+
+	w.buf.Write(p)
+	for {
+		line, err := w.buf.ReadString('\n')
+		if err != nil {
+			// Keep the incomplete line for the next write
+			w.buf.WriteString(line)
+			break
+		}
+		writeLog("info", line)
+	}
+	return len(p), nil
+}
+
+// Flush writes a trailing line that did not end with a newline
+func (w *logLineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.buf.Len() > 0 {
+		writeLog("info", w.buf.String())
+		w.buf.Reset()
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// logrotateConfigPath is where the generated logrotate config is kept alongside the rest of the config
+const logrotateConfigPath = "config/logrotate.conf"
+
+// writeLogrotateConfig generates a logrotate config for the Pangolin and Traefik log directories
+// and installs it into /etc/logrotate.d when running as root.
+func writeLogrotateConfig(config Config) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to determine install directory: %v", err)
+	}
+
+	content := fmt.Sprintf(`# Generated by the Pangolin installer
+%s %s {
+    maxsize %dM
+    maxage %d
+    rotate %d
+    missingok
+    notifempty
+    compress
+    delaycompress
+    copytruncate
+}
+`,
+		filepath.Join(dir, "config/logs/*.log"),
+		filepath.Join(dir, "config/traefik/logs/*.log"),
+		config.LogMaxSizeMB, config.LogMaxAgeDays, config.LogMaxFiles)
+
+	if err := os.WriteFile(logrotateConfigPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", logrotateConfigPath, err)
+	}
+
+	if _, err := os.Stat("/etc/logrotate.d"); err != nil || os.Geteuid() != 0 {
+		logInfo("Log rotation config written to %s. Copy it to /etc/logrotate.d/pangolin to enable it.", logrotateConfigPath)
+		return nil
+	}
+
+	if err := os.WriteFile("/etc/logrotate.d/pangolin", []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to install logrotate config: %v", err)
+	}
+	logInfo("Installed log rotation config to /etc/logrotate.d/pangolin")
+	return nil
+}
@@ -2,11 +2,13 @@ package main
 
 import (
 	"bufio"
+	"crypto/rand"
 	"embed"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/fs"
-	"math/rand"
 	"net"
 	"net/http"
 	"net/url"
@@ -14,7 +16,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"text/template"
 	"time"
 )
@@ -26,29 +30,141 @@ func loadVersions(config *Config) {
 	config.BadgerVersion = "replaceme"
 }
 
+// printVersion writes the component versions this installer deploys and its own build info to w
+func printVersion(w io.Writer) {
+	var config Config
+	loadVersions(&config)
+
+	fmt.Fprintf(w, "Pangolin: %s\n", config.PangolinVersion)
+	fmt.Fprintf(w, "Gerbil:   %s\n", config.GerbilVersion)
+	fmt.Fprintf(w, "Badger:   %s\n", config.BadgerVersion)
+
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Fprintln(w, "Installer build info is not available")
+		return
+	}
+	fmt.Fprintf(w, "Installer: %s (%s)\n", info.Main.Version, info.GoVersion)
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision", "vcs.time", "vcs.modified":
+			fmt.Fprintf(w, "  %s: %s\n", setting.Key, setting.Value)
+		}
+	}
+}
+
 //go:embed config/*
 var configFiles embed.FS
 
 type Config struct {
-	InstallationContainerType SupportedContainer
-	PangolinVersion           string
-	GerbilVersion             string
-	BadgerVersion             string
-	BaseDomain                string
-	DashboardDomain           string
-	EnableIPv6                bool
-	LetsEncryptEmail          string
-	EnableEmail               bool
-	EmailSMTPHost             string
-	EmailSMTPPort             int
-	EmailSMTPUser             string
-	EmailSMTPPass             string
-	EmailNoReply              string
-	InstallGerbil             bool
-	TraefikBouncerKey         string
-	DoCrowdsecInstall         bool
-	EnableGeoblocking         bool
-	Secret                    string
+	InstallationContainerType SupportedContainer `yaml:"-"`
+	PangolinVersion           string             `yaml:"-"`
+	GerbilVersion             string             `yaml:"-"`
+	BadgerVersion             string             `yaml:"-"`
+	BaseDomain                string             `yaml:"base_domain"`
+	DashboardDomain           string             `yaml:"dashboard_domain"`
+	EnableIPv6                bool               `yaml:"enable_ipv6"`
+	LetsEncryptEmail          string             `yaml:"lets_encrypt_email"`
+	AcmeChallenge             string             `yaml:"acme_challenge"`
+	AcmeCaServer              string             `yaml:"acme_ca_server"`
+	DNSProvider               string             `yaml:"dns_provider"`
+	DNSAPIToken               string             `yaml:"dns_api_token"`
+	EnableEmail               bool               `yaml:"enable_email"`
+	EmailSMTPHost             string             `yaml:"email_smtp_host"`
+	EmailSMTPPort             int                `yaml:"email_smtp_port"`
+	EmailSMTPUser             string             `yaml:"email_smtp_user"`
+	EmailSMTPPass             string             `yaml:"email_smtp_pass"`
+	EmailNoReply              string             `yaml:"email_no_reply"`
+	InstallGerbil             bool               `yaml:"install_gerbil"`
+	TraefikBouncerKey         string             `yaml:"-"`
+	DoCrowdsecInstall         bool               `yaml:"-"`
+	InstallCrowdsec           bool               `yaml:"install_crowdsec"`
+	EnableGeoblocking         bool               `yaml:"enable_geoblocking"`
+	Secret                    string             `yaml:"-"`
+	EnableMetrics             bool               `yaml:"enable_metrics"`
+	MetricsPort               int                `yaml:"metrics_port"`
+	MetricsAllowedIPs         []string           `yaml:"metrics_allowed_ips"`
+	LogMaxSizeMB              int                `yaml:"log_max_size_mb"`
+	LogMaxAgeDays             int                `yaml:"log_max_age_days"`
+	LogMaxFiles               int                `yaml:"log_max_files"`
+	AppEntrypoint             []string           `yaml:"app_entrypoint"`
+	AppCommand                []string           `yaml:"app_command"`
+	RegistryPrefix            string             `yaml:"registry_prefix"`
+	BindAddress               string             `yaml:"bind_address"`
+	ExternalProxy             bool               `yaml:"external_proxy"`
+	DbBackend                 string             `yaml:"db_backend"`
+	PostgresHost              string             `yaml:"postgres_host"`
+	PostgresPort              int                `yaml:"postgres_port"`
+	PostgresUser              string             `yaml:"postgres_user"`
+	PostgresPass              string             `yaml:"postgres_pass"`
+	PostgresDB                string             `yaml:"postgres_db"`
+	Timezone                  string             `yaml:"timezone"`
+	SiteDomains               []string           `yaml:"site_domains"`
+	ImageDigests              map[string]string  `yaml:"-"`
+}
+
+// defaultConfig returns the answers collectUserInput defaults to
+func defaultConfig() Config {
+	return Config{
+		AcmeChallenge:     acmeHTTPChallenge,
+		EnableIPv6:        true,
+		EmailSMTPPort:     587,
+		InstallGerbil:     true,
+		EnableGeoblocking: true,
+		DbBackend:         dbBackendSQLite,
+		PostgresPort:      5432,
+	}
+}
+
+// ImageRegistry returns the registry the images are pulled from, an empty
+// RegistryPrefix means the upstream default
+func (c Config) ImageRegistry() string {
+	if c.RegistryPrefix == "" {
+		return defaultRegistry
+	}
+	return c.RegistryPrefix
+}
+
+// PortBinding returns the host address prefix of the published ports, empty when they
+// are published on all addresses
+func (c Config) PortBinding() string {
+	if c.BindAddress == "" {
+		return ""
+	}
+	return net.JoinHostPort(c.BindAddress, "")
+}
+
+// WebHostPorts returns the host ports Traefik's HTTP and HTTPS entrypoints are published on
+func (c Config) WebHostPorts() []int {
+	if c.ExternalProxy {
+		return []int{externalProxyHTTPPort, externalProxyHTTPSPort}
+	}
+	return []int{80, 443}
+}
+
+// WebPorts returns the compose port mappings of Traefik's HTTP and HTTPS entrypoints. Behind
+// an external proxy they are only published on localhost, on ports that do not clash with it.
+func (c Config) WebPorts() []string {
+	prefix := c.PortBinding()
+	if c.ExternalProxy {
+		prefix = "127.0.0.1:"
+	}
+	ports := c.WebHostPorts()
+	return []string{fmt.Sprintf("%s%d:443", prefix, ports[1]), fmt.Sprintf("%s%d:80", prefix, ports[0])}
+}
+
+// CAServer returns the ACME directory the certificates are requested from, an empty
+// AcmeCaServer means the Let's Encrypt production directory
+func (c Config) CAServer() string {
+	if c.AcmeCaServer == "" {
+		return letsEncryptProduction
+	}
+	return c.AcmeCaServer
+}
+
+// DNSTokenEnv returns the environment variable Traefik reads the DNS provider credentials from
+func (c Config) DNSTokenEnv() string {
+	return dnsProviders[c.DNSProvider].TokenEnv
 }
 
 type SupportedContainer string
@@ -60,170 +176,666 @@ const (
 )
 
 func main() {
+	flag.Parse()
+	commandArgs, err := parseCommandArgs(flag.Args())
+	if err != nil {
+		logError("Error: %v", err)
+		exit(2)
+	}
 
-	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
+	if err := validateFlags(); err != nil {
+		logError("Error: %v", err)
+		exit(2)
+	}
+	resolveFlagAliases()
+	applyProxySettings()
 
-	fmt.Println("Welcome to the Pangolin installer!")
-	fmt.Println("This installer will help you set up Pangolin on your server.")
-	fmt.Println("\nPlease make sure you have the following prerequisites:")
-	fmt.Println("- Open TCP ports 80 and 443 and UDP ports 51820 and 21820 on your VPS and firewall.")
-	fmt.Println("\nLets get started!")
+	if err := validateTemplates(configFiles); err != nil {
+		logError("Error: this installer build is broken: %v", err)
+		exit(1)
+	}
+
+	if err := setupLogging(); err != nil {
+		logError("Error: %v", err)
+		exit(2)
+	}
 
-	if os.Geteuid() == 0 { // WE NEED TO BE SUDO TO CHECK THIS
-		for _, p := range []int{80, 443} {
-			if err := checkPortsAvailable(p); err != nil {
-				fmt.Fprintln(os.Stderr, err)
+	handleInterrupts()
+
+	if *versionFlag {
+		printVersion(os.Stdout)
+		return
+	}
 
-				fmt.Printf("Please close any services on ports 80/443 in order to run the installation smoothly. If you already have the Pangolin stack running, shut them down before proceeding.\n")
-				os.Exit(1)
+	if len(commandArgs) > 0 {
+		exit(runCommand(commandArgs))
+	}
+
+	if *statusFlag {
+		report := newReport("status")
+		report.Finish(stackStatus(report))
+		report.Print()
+		if !report.Success {
+			exit(1)
+		}
+		return
+	}
+
+	if *checkFirewallFlag {
+		report := newReport("check-firewall")
+		report.Finish(firewallReport(report))
+		report.Print()
+		if !report.Success {
+			exit(1)
+		}
+		return
+	}
+
+	if *listServicesFlag {
+		report := newReport("list-services")
+		report.Finish(listServices(report))
+		report.Print()
+		if !report.Success {
+			exit(1)
+		}
+		return
+	}
+
+	if *serviceLogsFlag != "" {
+		if err := streamServiceLogs(*serviceLogsFlag, *tailFlag); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *checkUpdatesFlag {
+		report := newReport("check-updates")
+		report.Finish(checkUpdates(report))
+		report.Print()
+		if !report.Success {
+			exit(1)
+		}
+		return
+	}
+
+	if *selfUpdateFlag {
+		if err := selfUpdate(); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *regenerateFlag != "" {
+		if err := regenerate(*regenerateFlag, stdinReader); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *restartFlag {
+		if err := restartStack(); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("All core services are running.")
+		return
+	}
+
+	if *updateFlag {
+		if err := updateStack(); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("Pangolin has been updated.")
+		return
+	}
+
+	if *reinstallFlag {
+		if err := reinstallContainers(); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("The containers have been recreated.")
+		return
+	}
+
+	if *repairPermsFlag {
+		if err := repairPermissions(); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *collectDiagnosticsFlag != "" {
+		if err := collectDiagnostics(*collectDiagnosticsFlag); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		return
+	}
+
+	if *backupFlag != "" {
+		reader := stdinReader
+		archivePath, err := createBackup(*backupFlag, reader)
+		if err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("Backup written to %s", archivePath)
+		if *backupRetentionFlag > 0 {
+			if err := pruneBackups(*backupFlag, *backupRetentionFlag, reader); err != nil {
+				logError("Error: %v", err)
+				exit(1)
 			}
 		}
+		return
+	}
+
+	if *listBackupsFlag != "" {
+		report := newReport("list-backups")
+		report.Finish(listBackups(*listBackupsFlag, report))
+		report.Print()
+		if !report.Success {
+			exit(1)
+		}
+		return
+	}
+
+	if *restoreFlag != "" {
+		if err := restoreBackup(*restoreFlag, stdinReader); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("The backup has been restored.")
+		return
+	}
+
+	if *uninstallFlag {
+		if err := uninstall(stdinReader); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		}
+		logInfo("\nPangolin has been uninstalled.")
+		return
 	}
 
-	reader := bufio.NewReader(os.Stdin)
+	// print a banner about prerequisites - opening port 80, 443, 51820, and 21820 on the VPS and firewall and pointing your domain to the VPS IP with a records. Docs are at http://localhost:3000/Getting%20Started/dns-networking
+
+	startResult()
+	defer writeResultFile(0)
+
+	logInfo("Welcome to the Pangolin installer!")
+	logInfo("This installer will help you set up Pangolin on your server.")
+	logInfo("\nPlease make sure you have the following prerequisites:")
+	logInfo("- Open TCP ports 80 and 443 and UDP ports 51820 and 21820 on your VPS and firewall.")
+	logInfo("\nLets get started!")
+
+	reader := stdinReader
 
 	var config Config
 	var alreadyInstalled = false
 
 	// check if there is already a config file
-	if _, err := os.Stat("config/config.yml"); err != nil {
-		config = collectUserInput(reader)
+	_, statErr := os.Stat("config/config.yml")
+	createdConfig := statErr != nil
+
+	// An install interrupted after writing the configuration continues from its last step
+	var resume *installState
+	if statErr == nil && *configFileFlag == "" {
+		if resume, config = offerResume(reader); resume != nil {
+			createdConfig = true
+		}
+	}
 
-		loadVersions(&config)
-		config.DoCrowdsecInstall = false
-		config.Secret = generateRandomSecretKey()
+	if statErr != nil || *configFileFlag != "" || resume != nil {
+		if resume == nil {
+			if *configFileFlag != "" {
+				if statErr == nil {
+					logWarn("Warning: config/config.yml already exists and will be overwritten with the answers from %s.", *configFileFlag)
+				}
+				answers, err := loadAnswerFile(*configFileFlag)
+				if err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				if !confirmDashboardDomain(reader, answers.DashboardDomain, answers.BaseDomain) {
+					exit(1)
+				}
+				if !confirmLetsEncryptEmail(reader, answers.LetsEncryptEmail) {
+					exit(1)
+				}
+				config = answers
+			} else {
+				if *quietFlag {
+					logError("Error: --quiet needs --config-file with the answers for a new installation")
+					exit(1)
+				}
+				config = collectUserInput(reader)
+			}
 
-		fmt.Println("\n=== Generating Configuration Files ===")
+			if err := applyFlags(&config); err != nil {
+				logError("Error: %v", err)
+				exit(1)
+			}
 
-		if err := createConfigFiles(config); err != nil {
-			fmt.Printf("Error creating config files: %v\n", err)
-			os.Exit(1)
-		}
+			if *generateAnswersFlag != "" {
+				if err := writeAnswerFile(config, *generateAnswersFlag, *includeSecretsFlag); err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				logInfo("Answers written to %s, replay them with --config-file %s", *generateAnswersFlag, *generateAnswersFlag)
+			}
+
+			loadVersions(&config)
+			recordResultConfig(config)
+			config.DoCrowdsecInstall = false
+			// Re-rendering over an existing installation keeps its secret so sessions stay valid
+			if statErr == nil && os.Getenv(secretEnv) == "" {
+				secret, err := installedSecret()
+				if err != nil {
+					logWarn("Warning: could not read the existing server secret, a new one will be generated: %v", err)
+				}
+				config.Secret = secret
+			}
+			if config.Secret == "" {
+				secret, err := serverSecret()
+				if err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				config.Secret = secret
+			}
+
+			if *printConfigFlag {
+				if err := printConfig(config); err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				return
+			}
+
+			if *exportComposeFlag {
+				if err := exportCompose(config, *outputFlag); err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				return
+			}
+
+			if *dryRunFlag {
+				dir, err := dryRun(config)
+				if err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				if *keepDryRunFlag {
+					logInfo("\nRendered files were kept in %s", dir)
+				} else {
+					os.RemoveAll(dir)
+				}
+				return
+			}
+
+			// Only a real install needs the resources, the modes above change nothing on this host
+			if statErr != nil {
+				if warnings := checkSystemResources(); len(warnings) > 0 {
+					for _, warning := range warnings {
+						logWarn("Warning: %s.", warning)
+					}
+					logInfo("Small servers tend to fail mid-install while pulling the images.")
+					if !confirm(reader, "ignore-low-resources", "Continue anyway?", false) {
+						exit(1)
+					}
+				}
+			}
+
+			checkDatabaseBackend(reader, config)
+
+			if err := confirmComposeOverwrite(reader, config, *composeFileFlag); err != nil {
+				logError("Error: %v", err)
+				exit(1)
+			}
+
+			logStep("Generating Configuration Files")
+
+			created, err := createConfigFiles(config)
+			if err != nil {
+				logError("Error creating config files: %v", err)
+				exit(1)
+			}
+			for _, path := range created {
+				if path != "config/docker-compose.yml" {
+					trackCreated(path)
+				}
+			}
 
-		moveFile("config/docker-compose.yml", "docker-compose.yml")
+			_, composeErr := os.Lstat(*composeFileFlag)
+			if err := moveFile("config/docker-compose.yml", *composeFileFlag); err != nil {
+				logError("Error moving the compose file into place: %v", err)
+				exit(1)
+			}
+			if os.IsNotExist(composeErr) {
+				trackCreated(*composeFileFlag)
+			}
 
-		fmt.Println("\nConfiguration files created successfully!")
+			if *swarmFlag {
+				if !isSwarmActive() {
+					logError("Error: --swarm was given but this Docker engine is not part of an active swarm. Run 'docker swarm init' first.")
+					exit(1)
+				}
+				if err := convertComposeForSwarm(*composeFileFlag); err != nil {
+					logError("Error preparing the compose file for swarm: %v", err)
+					exit(1)
+				}
+			}
+
+			if err := writeLogrotateConfig(config); err != nil {
+				logWarn("Warning: failed to set up log rotation: %v", err)
+			}
 
-		// Download MaxMind database if requested
-		if config.EnableGeoblocking {
-			fmt.Println("\n=== Downloading MaxMind Database ===")
-			if err := downloadMaxMindDatabase(); err != nil {
-				fmt.Printf("Error downloading MaxMind database: %v\n", err)
-				fmt.Println("You can download it manually later if needed.")
+			logInfo("\nConfiguration files created successfully!")
+			markInstallStep(stepConfigWritten)
+
+			// Download MaxMind database if requested
+			if config.EnableGeoblocking {
+				logStep("Downloading MaxMind Database")
+				_, mmdbErr := os.Lstat("config/GeoLite2-Country.mmdb")
+				if err := downloadMaxMindDatabase(); err != nil {
+					logError("Error downloading MaxMind database: %v", err)
+					logInfo("You can download it manually later if needed.")
+				} else if os.IsNotExist(mmdbErr) {
+					trackCreated("config/GeoLite2-Country.mmdb")
+				}
 			}
 		}
 
-		fmt.Println("\n=== Starting installation ===")
+		logStep("Starting installation")
 
-		if readBool(reader, "Would you like to install and start the containers?", true) {
+		if resume != nil || confirm(reader, "install-containers", "Would you like to install and start the containers?", true) {
 
 			config.InstallationContainerType = podmanOrDocker(reader)
 
-			if !isDockerInstalled() && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
-				if readBool(reader, "Docker is not installed. Would you like to install it?", true) {
-					installDocker()
-					// try to start docker service but ignore errors
-					if err := startDockerService(); err != nil {
-						fmt.Println("Error starting Docker service:", err)
-					} else {
-						fmt.Println("Docker service started successfully!")
+			if *swarmFlag && config.InstallationContainerType != Docker {
+				logError("Error: --swarm is only supported with Docker.")
+				exit(1)
+			}
+
+			if !isDockerInstalled() && !*skipDockerInstallFlag && runtime.GOOS == "linux" && config.InstallationContainerType == Docker {
+				if confirm(reader, "install-docker", "Docker is not installed. Would you like to install it?", true) {
+					if err := installDocker(); err != nil {
+						logError("Error installing Docker: %v", err)
+						exit(1)
 					}
-					// wait 10 seconds for docker to start checking if docker is running every 2 seconds
-					fmt.Println("Waiting for Docker to start...")
-					for i := 0; i < 5; i++ {
-						if isDockerRunning() {
-							fmt.Println("Docker is running!")
-							break
-						}
-						fmt.Println("Docker is not running yet, waiting...")
-						time.Sleep(2 * time.Second)
+					if !startDockerAndWait() {
+						logInfo("Docker is still not running after 10 seconds. Please check the installation.")
+						exit(1)
 					}
-					if !isDockerRunning() {
-						fmt.Println("Docker is still not running after 10 seconds. Please check the installation.")
-						os.Exit(1)
+					logInfo("Docker installed successfully!")
+				}
+			}
+
+			// Installed and usable by this user, but the daemon may still be stopped
+			if config.InstallationContainerType == Docker && !*swarmFlag && isDockerInstalled() && !isDockerRunning() {
+				logInfo("Docker is installed but the Docker daemon is not running.")
+				// Starting the system daemon is rarely what a rootless setup wants
+				rootless := warnRootlessDocker()
+				if !confirm(reader, "start-docker", "Would you like to start the Docker service?", !rootless) {
+					logInfo("Start the Docker service yourself, e.g. with 'systemctl start docker', then re-run the installer.")
+					exit(1)
+				}
+				if !startDockerAndWait() {
+					logInfo("Docker is still not running after 10 seconds. Check 'systemctl status docker' or the Docker logs.")
+					exit(1)
+				}
+			}
+
+			if config.InstallationContainerType == Docker && !*swarmFlag {
+				warnRootDockerRootless()
+			}
+			markInstallStep(stepDockerInstalled)
+
+			if resume.done(stepImagesPulled) {
+				logInfo("Skipping the pull, the images were pulled before the interruption.")
+			} else if err := pullContainers(config.InstallationContainerType); err != nil {
+				logError("Error: %v", err)
+				exit(1)
+			}
+			markInstallStep(stepImagesPulled)
+
+			if occupied := checkRequiredPorts(config.WebHostPorts()); len(occupied) > 0 {
+				for _, occupiedPort := range occupied {
+					families := strings.Join(occupiedPort.Families, ", ")
+					if owner := portOwner(occupiedPort.Port); owner != "" {
+						logWarn("Warning: port %d is already in use (%s) by %s.", occupiedPort.Port, families, owner)
+					} else {
+						logWarn("Warning: port %d is already in use (%s).", occupiedPort.Port, families)
 					}
-					fmt.Println("Docker installed successfully!")
+				}
+				ports := config.WebHostPorts()
+				logInfo("Traefik needs ports %d and %d, stop the other web server or the containers will fail to start.", ports[0], ports[1])
+				if !confirm(reader, "ignore-port-conflicts", "Continue anyway?", false) {
+					exit(1)
 				}
 			}
 
-			if err := pullContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
+			// Published only on localhost behind an external proxy, the firewall does not apply
+			if !config.ExternalProxy {
+				for _, warning := range checkFirewall(config.WebHostPorts()) {
+					logWarn("Warning: %s", warning)
+				}
+			}
+
+			if err := checkDNS(config); err != nil {
+				logWarn("Warning: %v.", err)
+				logInfo("Let's Encrypt cannot issue certificates until the DNS records point to this server. New records can take a while to propagate.")
+				if !confirm(reader, "ignore-dns-mismatch", "Continue anyway?", true) {
+					exit(1)
+				}
+			}
+
+			// An interrupted fresh install should not leave half started containers behind
+			if createdConfig {
+				containerType := config.InstallationContainerType
+				setInterruptCleanup(func() {
+					if *quietFlag || !isStdinTerminal() || readBoolOnInterrupt(reader, "Stop the containers this install started?", true) {
+						if err := stopContainers(containerType); err != nil {
+							logWarn("Warning: could not stop the containers: %v", err)
+						}
+					}
+				})
 			}
 
 			if err := startContainers(config.InstallationContainerType); err != nil {
-				fmt.Println("Error: ", err)
-				return
+				logError("Error: %v", err)
+				// Only offer to clean up files this run created, never an earlier installation
+				if createdConfig {
+					logInfo("\nThe containers could not be started, see the compose output above for details.")
+					if confirm(reader, "rollback", "Do you want to roll back, stopping the containers and removing the generated configuration?", true) {
+						if err := rollbackInstall(config.InstallationContainerType); err != nil {
+							logError("Error rolling back: %v", err)
+						} else {
+							logInfo("Rolled back, you can re-run the installer for a clean install.")
+						}
+					}
+				}
+				exit(1)
+			}
+			recordResult(func(result *installResult) { result.ContainersStarted = true })
+			markInstallStep(stepContainersStarted)
+
+			logInfo("Waiting for the core services...")
+			err := waitForCoreServices(config.InstallationContainerType)
+			setInterruptCleanup(nil)
+			if err != nil {
+				logWarn("Warning: %v, check the container logs before continuing.", err)
+			} else if config.ExternalProxy {
+				ports := config.WebHostPorts()
+				logInfo("\nTraefik is listening on 127.0.0.1:%d (HTTPS) and 127.0.0.1:%d (HTTP).", ports[1], ports[0])
+				logInfo("Point your reverse proxy for %s and the resource domains there, passing TLS through to the HTTPS port.", config.DashboardDomain)
+			} else if err := verifyDashboardReachable(config); err != nil {
+				logWarn("Warning: %v.", err)
+				logInfo("Check that ports 80 and 443 are open in your firewall and that the DNS records point to this server, then look at the Traefik logs with --service-logs traefik.")
+			} else {
+				logInfo("\nPangolin is up and reachable at https://%s", config.DashboardDomain)
 			}
 		}
+		clearInstallState()
 
 	} else {
 		alreadyInstalled = true
-		fmt.Println("Looks like you already installed Pangolin!")
+		logInfo("Looks like you already installed Pangolin!")
+
+		logStep("Checking Configuration")
+		if installed, err := loadInstalledConfig(); err != nil {
+			logInfo("Skipping the configuration check: %v", err)
+		} else if err := applyFlags(&installed); err != nil {
+			logError("Error: %v", err)
+			exit(1)
+		} else {
+			loadVersions(&installed)
+			recordResultConfig(installed)
+			if *printConfigFlag {
+				if err := printConfig(installed); err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				return
+			}
+			if *exportComposeFlag {
+				if err := exportCompose(installed, *outputFlag); err != nil {
+					logError("Error: %v", err)
+					exit(1)
+				}
+				return
+			}
+			if *reconcileFlag {
+				checkDatabaseBackend(reader, installed)
+			}
+			if err := reconcile(installed, *reconcileFlag); err != nil {
+				logError("Error reconciling the configuration: %v", err)
+				exit(1)
+			}
+		}
 		
 		// Check if MaxMind database exists and offer to update it
-		fmt.Println("\n=== MaxMind Database Update ===")
+		logStep("MaxMind Database Update")
 		if _, err := os.Stat("config/GeoLite2-Country.mmdb"); err == nil {
-			fmt.Println("MaxMind GeoLite2 Country database found.")
-			if readBool(reader, "Would you like to update the MaxMind database to the latest version?", false) {
+			logInfo("MaxMind GeoLite2 Country database found.")
+			if confirm(reader, "update-maxmind", "Would you like to update the MaxMind database to the latest version?", false) {
 				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error updating MaxMind database: %v\n", err)
-					fmt.Println("You can try updating it manually later if needed.")
+					logError("Error updating MaxMind database: %v", err)
+					logInfo("You can try updating it manually later if needed.")
 				}
 			}
 		} else {
-			fmt.Println("MaxMind GeoLite2 Country database not found.")
-			if readBool(reader, "Would you like to download the MaxMind GeoLite2 database for geoblocking functionality?", false) {
+			logInfo("MaxMind GeoLite2 Country database not found.")
+			if confirm(reader, "update-maxmind", "Would you like to download the MaxMind GeoLite2 database for geoblocking functionality?", false) {
 				if err := downloadMaxMindDatabase(); err != nil {
-					fmt.Printf("Error downloading MaxMind database: %v\n", err)
-					fmt.Println("You can try downloading it manually later if needed.")
+					logError("Error downloading MaxMind database: %v", err)
+					logInfo("You can try downloading it manually later if needed.")
 				}
 				// Now you need to update your config file accordingly to enable geoblocking
-				fmt.Println("Please remember to update your config/config.yml file to enable geoblocking! \n")
+				logInfo("Please remember to update your config/config.yml file to enable geoblocking!")
 				// add   maxmind_db_path: "./config/GeoLite2-Country.mmdb" under server
-				fmt.Println("Add the following line under the 'server' section:")
-				fmt.Println("  maxmind_db_path: \"./config/GeoLite2-Country.mmdb\"")
+				logInfo("Add the following line under the 'server' section:")
+				logInfo("  maxmind_db_path: \"./config/GeoLite2-Country.mmdb\"")
 			}
 		}
 	}
 
-	if !checkIsCrowdsecInstalledInCompose() {
-		fmt.Println("\n=== CrowdSec Install ===")
+	if *swarmFlag {
+		logInfo("\nSkipping the CrowdSec install, it is not supported in swarm mode.")
+	} else if installed, err := checkIsCrowdsecInstalledInCompose(*composeFileFlag); err != nil {
+		logWarn("Warning: skipping the CrowdSec install, could not check %s for it: %v", *composeFileFlag, err)
+	} else if !installed {
+		logStep("CrowdSec Install")
 		// check if crowdsec is installed
-		if readBool(reader, "Would you like to install CrowdSec?", false) {
-			fmt.Println("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
+		// Selecting CrowdSec in the component selection answers both questions
+		if (config.InstallCrowdsec && !isFlagSet("install-crowdsec")) || confirm(reader, "install-crowdsec", "Would you like to install CrowdSec?", false) {
+			logInfo("This installer constitutes a minimal viable CrowdSec deployment. CrowdSec will add extra complexity to your Pangolin installation and may not work to the best of its abilities out of the box. Users are expected to implement configuration adjustments on their own to achieve the best security posture. Consult the CrowdSec documentation for detailed configuration instructions.")
 
 			// BUG: crowdsec installation will be skipped if the user chooses to install on the first installation.
-			if readBool(reader, "Are you willing to manage CrowdSec?", false) {
+			// Passing --install-crowdsec or --enable-crowdsec already accepts managing it
+			if isFlagSet("install-crowdsec") || config.InstallCrowdsec || readBool(reader, "Are you willing to manage CrowdSec?", false) {
 				if config.DashboardDomain == "" {
 					traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml")
 					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
+						logWarn("Warning: could not recover the Traefik settings: %v", err)
+						traefikConfig = &TraefikConfigValues{}
 					}
 					appConfig, err := ReadAppConfig("config/config.yml")
 					if err != nil {
-						fmt.Printf("Error reading config: %v\n", err)
-						return
+						logError("Error reading config: %v", err)
+						exit(1)
 					}
 
-					parsedURL, err := url.Parse(appConfig.DashboardURL)
-					if err != nil {
-                        fmt.Printf("Error parsing URL: %v\n", err)
-                        return
+					if parsedURL, err := url.Parse(appConfig.DashboardURL); err != nil {
+						logWarn("Warning: could not parse the dashboard URL: %v", err)
+					} else if ok, reason := validateDomain(parsedURL.Hostname()); !ok {
+						logWarn("Warning: invalid dashboard domain %q in config/config.yml: %s", parsedURL.Hostname(), reason)
+					} else {
+						config.DashboardDomain = parsedURL.Hostname()
 					}
-
-					config.DashboardDomain = parsedURL.Hostname()
 					config.LetsEncryptEmail = traefikConfig.LetsEncryptEmail
 					config.BadgerVersion = traefikConfig.BadgerVersion
+					config.AcmeCaServer = traefikConfig.CAServer
+					// The CrowdSec Traefik overlay has to keep the challenge of the installation
+					if traefikConfig.DNSProvider != "" {
+						config.AcmeChallenge = acmeDNSChallenge
+						config.DNSProvider = traefikConfig.DNSProvider
+					}
+					// Pull CrowdSec from the same mirror as the rest of the stack
+					if services, err := readComposeServices(*composeFileFlag); err == nil {
+						if pangolin, ok := services["pangolin"].(map[string]interface{}); ok {
+							config.RegistryPrefix = registryPrefixOf(pangolin["image"])
+						}
+						config.Timezone = serviceTimezone(services["pangolin"])
+					}
+					if isFlagSet("image-lock") {
+						digests, err := loadImageLock(*imageLockFlag)
+						if err != nil {
+							logError("Error: %v", err)
+							exit(1)
+						}
+						config.ImageDigests = digests
+					}
+					if isFlagSet("registry") {
+						prefix, err := normalizeRegistryPrefix(*registryFlag)
+						if err != nil {
+							logError("Error: invalid registry: %v", err)
+							exit(1)
+						}
+						config.RegistryPrefix = prefix
+					}
+
+					// Prompt for whatever could not be recovered instead of rendering empty values
+					if *quietFlag && (config.DashboardDomain == "" || config.LetsEncryptEmail == "") {
+						logError("Error: could not recover the dashboard domain and Let's Encrypt email from the existing configuration, rerun without --quiet")
+						exit(1)
+					}
+					if config.DashboardDomain == "" {
+						config.DashboardDomain = readValidatedString(reader, "Enter the domain for the Pangolin dashboard", "", validateDomain)
+					}
+					if config.LetsEncryptEmail == "" {
+						config.LetsEncryptEmail = readLetsEncryptEmail(reader, "")
+					}
+					if config.BadgerVersion == "" {
+						var versions Config
+						loadVersions(&versions)
+						config.BadgerVersion = versions.BadgerVersion
+					}
 
 					// print the values and check if they are right
-					fmt.Println("Detected values:")
-					fmt.Printf("Dashboard Domain: %s\n", config.DashboardDomain)
-					fmt.Printf("Let's Encrypt Email: %s\n", config.LetsEncryptEmail)
-					fmt.Printf("Badger Version: %s\n", config.BadgerVersion)
+					logInfo("Detected values:")
+					logInfo("Dashboard Domain: %s", config.DashboardDomain)
+					logInfo("Let's Encrypt Email: %s", config.LetsEncryptEmail)
+					logInfo("Badger Version: %s", config.BadgerVersion)
 
-					if !readBool(reader, "Are these values correct?", true) {
+					if !*quietFlag && !readBool(reader, "Are these values correct?", true) {
 						config = collectUserInput(reader)
 					}
 				}
@@ -233,11 +845,12 @@ func main() {
 				config.DoCrowdsecInstall = true
 				err := installCrowdsec(config)
 				if err != nil {
-					fmt.Printf("Error installing CrowdSec: %v\n", err)
-					return
+					logError("Error installing CrowdSec: %v", err)
+					exit(1)
 				}
 
-				fmt.Println("CrowdSec installed successfully!")
+				recordResult(func(result *installResult) { result.CrowdSecInstalled = true })
+				logInfo("CrowdSec installed successfully!")
 				return
 			}
 		}
@@ -245,7 +858,7 @@ func main() {
 
 	if !alreadyInstalled {
 		// Setup Token Section
-		fmt.Println("\n=== Setup Token ===")
+		logStep("Setup Token")
 
 		// Check if containers were started during this installation
 		containersStarted := false
@@ -262,13 +875,17 @@ func main() {
 		}
 	}
 
-	fmt.Println("\nInstallation complete!")
+	logInfo("\nInstallation complete!")
 
-	fmt.Printf("\nTo complete the initial setup, please visit:\nhttps://%s/auth/initial-setup\n", config.DashboardDomain)
+	logInfo("\nTo complete the initial setup, please visit:\nhttps://%s/auth/initial-setup", config.DashboardDomain)
 }
 
 func podmanOrDocker(reader *bufio.Reader) SupportedContainer {
-	inputContainer := readString(reader, "Would you like to run Pangolin as Docker or Podman containers?", "docker")
+	inputContainer := *runtimeFlag
+	if inputContainer == "" {
+		failQuiet("runtime", "Would you like to run Pangolin as Docker or Podman containers?")
+		inputContainer = readString(reader, "Would you like to run Pangolin as Docker or Podman containers?", "docker")
+	}
 
 	chosenContainer := Docker
 	if strings.EqualFold(inputContainer, "docker") {
@@ -276,24 +893,24 @@ func podmanOrDocker(reader *bufio.Reader) SupportedContainer {
 	} else if strings.EqualFold(inputContainer, "podman") {
 		chosenContainer = Podman
 	} else {
-		fmt.Printf("Unrecognized container type: %s. Valid options are 'docker' or 'podman'.\n", inputContainer)
-		os.Exit(1)
+		logInfo("Unrecognized container type: %s. Valid options are 'docker' or 'podman'.", inputContainer)
+		exit(1)
 	}
 
 	if chosenContainer == Podman {
 		if !isPodmanInstalled() {
-			fmt.Println("Podman or podman-compose is not installed. Please install both manually. Automated installation will be available in a later release.")
-			os.Exit(1)
+			logInfo("Podman or a compose provider (podman-compose or podman compose) is not installed. Please install both manually. Automated installation will be available in a later release.")
+			exit(1)
 		}
 
 		if err := exec.Command("bash", "-c", "cat /etc/sysctl.conf | grep 'net.ipv4.ip_unprivileged_port_start='").Run(); err != nil {
-			fmt.Println("Would you like to configure ports >= 80 as unprivileged ports? This enables podman containers to listen on low-range ports.")
-			fmt.Println("Pangolin will experience startup issues if this is not configured, because it needs to listen on port 80/443 by default.")
-			approved := readBool(reader, "The installer is about to execute \"echo 'net.ipv4.ip_unprivileged_port_start=80' >> /etc/sysctl.conf && sysctl -p\". Approve?", true)
+			logInfo("Would you like to configure ports >= 80 as unprivileged ports? This enables podman containers to listen on low-range ports.")
+			logInfo("Pangolin will experience startup issues if this is not configured, because it needs to listen on port 80/443 by default.")
+			approved := confirm(reader, "unprivileged-ports", "The installer is about to execute \"echo 'net.ipv4.ip_unprivileged_port_start=80' >> /etc/sysctl.conf && sysctl -p\". Approve?", true)
 			if approved {
 				if os.Geteuid() != 0 {
-					fmt.Println("You need to run the installer as root for such a configuration.")
-					os.Exit(1)
+					logInfo("You need to run the installer as root for such a configuration.")
+					exit(1)
 				}
 
 				// Podman containers are not able to listen on privileged ports. The official recommendation is to
@@ -301,34 +918,39 @@ func podmanOrDocker(reader *bufio.Reader) SupportedContainer {
 				// Linux only.
 
 				if err := run("bash", "-c", "echo 'net.ipv4.ip_unprivileged_port_start=80' >> /etc/sysctl.conf && sysctl -p"); err != nil {
-					fmt.Sprintf("failed to configure unprivileged ports: %v.\n", err)
-					os.Exit(1)
+					logError("failed to configure unprivileged ports: %v.", err)
+					exit(1)
 				}
 			} else {
-				fmt.Println("You need to configure port forwarding or adjust the listening ports before running pangolin.")
+				logInfo("You need to configure port forwarding or adjust the listening ports before running pangolin.")
 			}
 		} else {
-			fmt.Println("Unprivileged ports have been configured.")
+			logInfo("Unprivileged ports have been configured.")
 		}
 
 	} else if chosenContainer == Docker {
 		// check if docker is not installed and the user is root
 		if !isDockerInstalled() {
+			if *skipDockerInstallFlag {
+				logInfo("Docker is not installed and --skip-docker-install is set.")
+				logInfo("Install Docker and the compose plugin with your platform's tooling (see https://docs.docker.com/engine/install/), then re-run the installer.")
+				exit(1)
+			}
 			if os.Geteuid() != 0 {
-				fmt.Println("Docker is not installed. Please install Docker manually or run this installer as root.")
-				os.Exit(1)
+				logInfo("Docker is not installed. Please install Docker manually or run this installer as root.")
+				exit(1)
 			}
 		}
 
 		// check if the user is in the docker group (linux only)
 		if !isUserInDockerGroup() {
-			fmt.Println("You are not in the docker group.")
-			fmt.Println("The installer will not be able to run docker commands without running it as root.")
-			os.Exit(1)
+			logInfo("You are not in the docker group.")
+			logInfo("The installer will not be able to run docker commands without running it as root.")
+			exit(1)
 		}
 	} else {
 		// This shouldn't happen unless there's a third container runtime.
-		os.Exit(1)
+		exit(1)
 	}
 
 	return chosenContainer
@@ -338,61 +960,209 @@ func collectUserInput(reader *bufio.Reader) Config {
 	config := Config{}
 
 	// Basic configuration
-	fmt.Println("\n=== Basic Configuration ===")
+	logStep("Basic Configuration")
 
-	config.BaseDomain = readString(reader, "Enter your base domain (no subdomain e.g. example.com)", "")
+	config.BaseDomain = readValidatedString(reader, "Enter your base domain (no subdomain e.g. example.com)", "", validateDomain)
 
 	// Set default dashboard domain after base domain is collected
-	defaultDashboardDomain := ""
-	if config.BaseDomain != "" {
-		defaultDashboardDomain = "pangolin." + config.BaseDomain
-	}
-	config.DashboardDomain = readString(reader, "Enter the domain for the Pangolin dashboard", defaultDashboardDomain)
-	config.LetsEncryptEmail = readString(reader, "Enter email for Let's Encrypt certificates", "")
-	config.InstallGerbil = readBool(reader, "Do you want to use Gerbil to allow tunneled connections", true)
+	defaultDashboardDomain := "pangolin." + config.BaseDomain
+	config.DashboardDomain = readDashboardDomain(reader, config.BaseDomain, defaultDashboardDomain)
+	config.SiteDomains = readSiteDomains(reader, config.BaseDomain, nil)
+	config.LetsEncryptEmail = readLetsEncryptEmail(reader, "")
+	collectAcmeConfig(reader, &config)
 
-	// Email configuration
-	fmt.Println("\n=== Email Configuration ===")
-	config.EnableEmail = readBool(reader, "Enable email functionality (SMTP)", false)
+	config.InstallGerbil = true
+	selectComponents(reader, &config)
 
 	if config.EnableEmail {
-		config.EmailSMTPHost = readString(reader, "Enter SMTP host", "")
-		config.EmailSMTPPort = readInt(reader, "Enter SMTP port (default 587)", 587)
-		config.EmailSMTPUser = readString(reader, "Enter SMTP username", "")
-		config.EmailSMTPPass = readString(reader, "Enter SMTP password", "") // Should this be readPassword?
-		config.EmailNoReply = readString(reader, "Enter no-reply email address", "")
-	}
-
-	// Validate required fields
-	if config.BaseDomain == "" {
-		fmt.Println("Error: Domain name is required")
-		os.Exit(1)
-	}
-	if config.LetsEncryptEmail == "" {
-		fmt.Println("Error: Let's Encrypt email is required")
-		os.Exit(1)
+		// Email configuration
+		logStep("Email Configuration")
+		collectEmailConfig(reader, &config)
 	}
 
 	// Advanced configuration
 
-	fmt.Println("\n=== Advanced Configuration ===")
+	logStep("Advanced Configuration")
 
 	config.EnableIPv6 = readBool(reader, "Is your server IPv6 capable?", true)
 	config.EnableGeoblocking = readBool(reader, "Do you want to download the MaxMind GeoLite2 database for geoblocking functionality?", true)
-
-	if config.DashboardDomain == "" {
-		fmt.Println("Error: Dashboard Domain name is required")
-		os.Exit(1)
+	if readBool(reader, "Do you want to use an external PostgreSQL database instead of SQLite?", false) {
+		config.DbBackend = dbBackendPostgres
+		collectPostgresConfig(reader, &config)
 	}
 
+	reviewConfig(reader, &config)
+
 	return config
 }
 
-func createConfigFiles(config Config) error {
-	os.MkdirAll("config", 0755)
-	os.MkdirAll("config/letsencrypt", 0755)
-	os.MkdirAll("config/db", 0755)
-	os.MkdirAll("config/logs", 0755)
+// readDashboardDomain prompts for the dashboard domain until it is valid and, when it is
+// outside baseDomain, confirmed as intentional
+func readDashboardDomain(reader *bufio.Reader, baseDomain string, defaultValue string) string {
+	for {
+		domain := readValidatedString(reader, "Enter the domain for the Pangolin dashboard", defaultValue, validateDomain)
+		if confirmDashboardDomain(reader, domain, baseDomain) {
+			return domain
+		}
+		if stdinClosed {
+			logError("Error: no more input available")
+			exit(1)
+		}
+	}
+}
+
+// readLetsEncryptEmail prompts for the Let's Encrypt email until it is valid and, when it looks
+// disposable or like a placeholder, confirmed as intentional
+func readLetsEncryptEmail(reader *bufio.Reader, defaultValue string) string {
+	for {
+		email := readValidatedString(reader, "Enter email for Let's Encrypt certificates", defaultValue, validateEmail)
+		if confirmLetsEncryptEmail(reader, email) {
+			return email
+		}
+		if stdinClosed {
+			logError("Error: no more input available")
+			exit(1)
+		}
+	}
+}
+
+// confirmLetsEncryptEmail warns when the Let's Encrypt email would never be read, so the
+// certificate expiry notices get lost, and asks whether to use it anyway
+func confirmLetsEncryptEmail(reader *bufio.Reader, email string) bool {
+	reason := suspiciousEmail(email)
+	if reason == "" {
+		return true
+	}
+	logWarn("Warning: %s, Let's Encrypt could not reach you about your certificates.", reason)
+	return confirm(reader, "allow-any-email", "Use "+email+" anyway?", false)
+}
+
+// confirmDashboardDomain warns when the dashboard domain is not baseDomain or one of its
+// subdomains, which is usually a typo, and asks whether to use it anyway
+func confirmDashboardDomain(reader *bufio.Reader, domain string, baseDomain string) bool {
+	if isSubdomainOf(domain, baseDomain) {
+		return true
+	}
+	logWarn("Warning: the dashboard domain %s is not %s or a subdomain of it.", domain, baseDomain)
+	return confirm(reader, "allow-external-dashboard-domain", "Use "+domain+" for the dashboard anyway?", false)
+}
+
+// collectAcmeConfig asks whether the certificates are issued with the DNS-01 challenge, which
+// also allows a wildcard certificate for the base domain, and for the provider credentials
+func collectAcmeConfig(reader *bufio.Reader, config *Config) {
+	config.AcmeChallenge = acmeHTTPChallenge
+	if !readBool(reader, "Do you want a wildcard certificate using the DNS-01 challenge (needs an API token of your DNS provider)", false) {
+		return
+	}
+	config.AcmeChallenge = acmeDNSChallenge
+
+	names := dnsProviderNames()
+	config.DNSProvider = readValidatedString(reader, "Enter your DNS provider ("+strings.Join(names, ", ")+")", config.DNSProvider, func(value string) (bool, string) {
+		if _, ok := dnsProviders[value]; !ok {
+			return false, "the DNS provider must be one of " + strings.Join(names, ", ")
+		}
+		return true, ""
+	})
+
+	provider := dnsProviders[config.DNSProvider]
+	if token := dnsProviderToken(provider); token != "" {
+		if *dnsAPITokenFlag == "" {
+			logInfo("Using the %s API token from %s", config.DNSProvider, provider.TokenEnv)
+		}
+		config.DNSAPIToken = token
+		return
+	}
+	config.DNSAPIToken = readPassword("Enter the "+config.DNSProvider+" API token", reader)
+}
+
+// collectEmailConfig asks for the SMTP settings, re-asking while the optional connection test fails
+func collectEmailConfig(reader *bufio.Reader, config *Config) {
+	for {
+		config.EmailSMTPHost = readString(reader, "Enter SMTP host", "")
+		config.EmailSMTPPort = readIntInRange(reader, "Enter SMTP port", 587, 1, 65535)
+		if !commonSMTPPorts[config.EmailSMTPPort] {
+			logWarn("Warning: %d is not a common SMTP port (25, 465, 587 or 2525), make sure it is correct.", config.EmailSMTPPort)
+		}
+		config.EmailSMTPUser = readString(reader, "Enter SMTP username", "")
+		if pass, ok := os.LookupEnv(smtpPassEnv); ok {
+			logInfo("Using the SMTP password from %s", smtpPassEnv)
+			config.EmailSMTPPass = pass
+		} else {
+			config.EmailSMTPPass = readPassword("Enter SMTP password", reader)
+		}
+		config.EmailNoReply = readValidatedString(reader, "Enter no-reply email address", "", validateEmail)
+
+		if !readBool(reader, "Test SMTP connection now?", true) {
+			break
+		}
+		logInfo("Testing SMTP connection...")
+		if err := testSMTPConnection(*config); err != nil {
+			logInfo("SMTP test failed: %v", err)
+			if readBool(reader, "Re-enter the email settings?", true) && !stdinClosed {
+				continue
+			}
+			break
+		}
+		logInfo("SMTP connection successful.")
+		break
+	}
+}
+
+// createConfigFiles renders the config files into a staging directory and only moves them
+// into place once every template succeeded, so a failure leaves config/ untouched. It returns
+// the files and directories that did not exist before, parents first.
+func createConfigFiles(config Config) ([]string, error) {
+	// Stage next to config/ so the final renames stay on the same filesystem
+	stagingDir, err := os.MkdirTemp(".", ".config-staging-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %v", err)
+	}
+	defer os.RemoveAll(stagingDir)
+
+	if err := renderConfigFiles(config, stagingDir); err != nil {
+		return nil, err
+	}
+
+	var created []string
+	err = filepath.WalkDir(stagingDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(stagingDir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		_, statErr := os.Lstat(rel)
+
+		if d.IsDir() {
+			if err := os.MkdirAll(rel, 0755); err != nil {
+				return fmt.Errorf("failed to create directory %s: %v", rel, err)
+			}
+		} else if err := os.Rename(path, rel); err != nil {
+			return fmt.Errorf("failed to move %s into place: %v", rel, err)
+		}
+		if os.IsNotExist(statErr) {
+			created = append(created, rel)
+		}
+		return nil
+	})
+	return created, err
+}
+
+// privateConfigFiles are the rendered files that hold credentials only their owner may read
+var privateConfigFiles = map[string]bool{
+	dnsEnvFile: true,
+}
+
+// dnsEnvFile passes the DNS provider credentials to Traefik, so they stay out of the compose file
+const dnsEnvFile = "config/traefik/dns.env"
+
+// renderConfigFiles renders the embedded config templates below outDir
+func renderConfigFiles(config Config, outDir string) error {
+	os.MkdirAll(filepath.Join(outDir, "config"), 0755)
+	os.MkdirAll(filepath.Join(outDir, "config/letsencrypt"), 0755)
+	os.MkdirAll(filepath.Join(outDir, "config/db"), 0755)
+	os.MkdirAll(filepath.Join(outDir, "config/logs"), 0755)
 
 	// Walk through all embedded files
 	err := fs.WalkDir(configFiles, "config", func(path string, d fs.DirEntry, err error) error {
@@ -405,11 +1175,7 @@ func createConfigFiles(config Config) error {
 			return nil
 		}
 
-		if !config.DoCrowdsecInstall && strings.Contains(path, "crowdsec") {
-			return nil
-		}
-
-		if config.DoCrowdsecInstall && !strings.Contains(path, "crowdsec") {
+		if !templateSelected(path, &config) {
 			return nil
 		}
 
@@ -418,9 +1184,11 @@ func createConfigFiles(config Config) error {
 			return nil
 		}
 
+		outPath := filepath.Join(outDir, path)
+
 		if d.IsDir() {
 			// Create directory
-			if err := os.MkdirAll(path, 0755); err != nil {
+			if err := os.MkdirAll(outPath, 0755); err != nil {
 				return fmt.Errorf("failed to create directory %s: %v", path, err)
 			}
 			return nil
@@ -432,19 +1200,28 @@ func createConfigFiles(config Config) error {
 			return fmt.Errorf("failed to read %s: %v", path, err)
 		}
 
+		// A blank secret would render fine but break every session
+		if config.Secret == "" && strings.Contains(string(content), "{{.Secret") {
+			return fmt.Errorf("refusing to render %s without a server secret", path)
+		}
+
 		// Parse template
-		tmpl, err := template.New(d.Name()).Parse(string(content))
+		tmpl, err := template.New(d.Name()).Funcs(templateFuncs).Parse(string(content))
 		if err != nil {
 			return fmt.Errorf("failed to parse template %s: %v", path, err)
 		}
 
 		// Ensure parent directory exists
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		if err := os.MkdirAll(filepath.Dir(outPath), 0755); err != nil {
 			return fmt.Errorf("failed to create parent directory for %s: %v", path, err)
 		}
 
-		// Create output file
-		outFile, err := os.Create(path)
+		// Create output file, files holding credentials are readable only by their owner
+		mode := os.FileMode(0644)
+		if privateConfigFiles[path] {
+			mode = 0600
+		}
+		outFile, err := os.OpenFile(outPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
 		if err != nil {
 			return fmt.Errorf("failed to create %s: %v", path, err)
 		}
@@ -464,6 +1241,7 @@ func createConfigFiles(config Config) error {
 	return nil
 }
 
+// copyFile copies src to dst and gives dst the permissions of src
 func copyFile(src, dst string) error {
 	source, err := os.Open(src)
 	if err != nil {
@@ -471,30 +1249,51 @@ func copyFile(src, dst string) error {
 	}
 	defer source.Close()
 
-	destination, err := os.Create(dst)
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	destination, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, info.Mode().Perm())
 	if err != nil {
 		return err
 	}
 	defer destination.Close()
 
+	// OpenFile applies the umask and keeps the mode of an existing dst, so set the mode
+	// before writing and a private file is never readable by others
+	if err := destination.Chmod(info.Mode().Perm()); err != nil {
+		return err
+	}
 	_, err = io.Copy(destination, source)
 	return err
 }
 
+// renameFile is os.Rename, replaced in tests to simulate a move across devices
+var renameFile = os.Rename
+
+// moveFile renames src to dst and falls back to copying when they are on different devices
 func moveFile(src, dst string) error {
-	if err := copyFile(src, dst); err != nil {
+	err := renameFile(src, dst)
+	if err == nil || !errors.Is(err, syscall.EXDEV) {
 		return err
 	}
 
-	return os.Remove(src)
+	if err := copyFile(src, dst); err != nil {
+		return err
+	}
+	if err := os.Remove(src); err != nil {
+		return fmt.Errorf("copied %s to %s but could not remove the original: %v", src, dst, err)
+	}
+	return nil
 }
 
 func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
-	fmt.Println("Waiting for Pangolin to generate setup token...")
+	logInfo("Waiting for Pangolin to generate setup token...")
 
 	// Wait for Pangolin to be healthy
-	if err := waitForContainer("pangolin", containerType); err != nil {
-		fmt.Println("Warning: Pangolin container did not become healthy in time.")
+	if err := waitForContainerHealthy("pangolin", containerType, *containerWaitTimeoutFlag, *healthcheckIntervalFlag); err != nil {
+		logWarn("Warning: Pangolin container did not become healthy in time.")
 		return
 	}
 
@@ -503,14 +1302,16 @@ func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
 
 	// Fetch logs
 	var cmd *exec.Cmd
-	if containerType == Docker {
+	if containerType == Docker && *swarmFlag {
+		cmd = exec.Command("docker", "service", "logs", "--raw", swarmServiceName("pangolin"))
+	} else if containerType == Docker {
 		cmd = exec.Command("docker", "logs", "pangolin")
 	} else {
 		cmd = exec.Command("podman", "logs", "pangolin")
 	}
 	output, err := cmd.Output()
 	if err != nil {
-		fmt.Println("Warning: Could not fetch Pangolin logs to find setup token.")
+		logWarn("Warning: Could not fetch Pangolin logs to find setup token.")
 		return
 	}
 
@@ -526,66 +1327,109 @@ func printSetupToken(containerType SupportedContainer, dashboardDomain string) {
 					tokenStart := strings.Index(trimmedLine, "Token:")
 					if tokenStart != -1 {
 						token := strings.TrimSpace(trimmedLine[tokenStart+6:])
-						fmt.Printf("Setup token: %s\n", token)
-						fmt.Println("")
-						fmt.Println("This token is required to register the first admin account in the web UI at:")
-						fmt.Printf("https://%s/auth/initial-setup\n", dashboardDomain)
-						fmt.Println("")
-						fmt.Println("Save this token securely. It will be invalid after the first admin is created.")
+						logInfo("Setup token: %s", token)
+						logInfo("")
+						logInfo("This token is required to register the first admin account in the web UI at:")
+						logInfo("https://%s/auth/initial-setup", dashboardDomain)
+						logInfo("")
+						logInfo("Save this token securely. It will be invalid after the first admin is created.")
 						return
 					}
 				}
 			}
 		}
 	}
-	fmt.Println("Warning: Could not find a setup token in Pangolin logs.")
+	logWarn("Warning: Could not find a setup token in Pangolin logs.")
 }
 
 func showSetupTokenInstructions(containerType SupportedContainer, dashboardDomain string) {
-	fmt.Println("\n=== Setup Token Instructions ===")
-	fmt.Println("To get your setup token, you need to:")
-	fmt.Println("")
-	fmt.Println("1. Start the containers")
+	logStep("Setup Token Instructions")
+	logInfo("To get your setup token, you need to:")
+	logInfo("")
+	logInfo("1. Start the containers")
 	if containerType == Docker {
-		fmt.Println("   docker compose up -d")
+		logInfo("   docker compose up -d")
 	} else if containerType == Podman {
-		fmt.Println("   podman-compose up -d")
+		logInfo("   podman-compose up -d")
 	} else {
 	}
-	fmt.Println("")
-	fmt.Println("2. Wait for the Pangolin container to start and generate the token")
-	fmt.Println("")
-	fmt.Println("3. Check the container logs for the setup token")
+	logInfo("")
+	logInfo("2. Wait for the Pangolin container to start and generate the token")
+	logInfo("")
+	logInfo("3. Check the container logs for the setup token")
 	if containerType == Docker {
-		fmt.Println("   docker logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
+		logInfo("   docker logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
 	} else if containerType == Podman {
-		fmt.Println("   podman logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
+		logInfo("   podman logs pangolin | grep -A 2 -B 2 'SETUP TOKEN'")
 	} else {
 	}
-	fmt.Println("")
-	fmt.Println("4. Look for output like")
-	fmt.Println("   === SETUP TOKEN GENERATED ===")
-	fmt.Println("   Token: [your-token-here]")
-	fmt.Println("   Use this token on the initial setup page")
-	fmt.Println("")
-	fmt.Println("5. Use the token to complete initial setup at")
-	fmt.Printf("   https://%s/auth/initial-setup\n", dashboardDomain)
-	fmt.Println("")
-	fmt.Println("The setup token is required to register the first admin account.")
-	fmt.Println("Save it securely - it will be invalid after the first admin is created.")
-	fmt.Println("================================")
+	logInfo("")
+	logInfo("4. Look for output like")
+	logInfo("   === SETUP TOKEN GENERATED ===")
+	logInfo("   Token: [your-token-here]")
+	logInfo("   Use this token on the initial setup page")
+	logInfo("")
+	logInfo("5. Use the token to complete initial setup at")
+	logInfo("   https://%s/auth/initial-setup", dashboardDomain)
+	logInfo("")
+	logInfo("The setup token is required to register the first admin account.")
+	logInfo("Save it securely - it will be invalid after the first admin is created.")
+	logInfo("================================")
 }
 
-func generateRandomSecretKey() string {
-	const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
-	const length = 32
+const (
+	// acmeHTTPChallenge and acmeDNSChallenge are the values of Config.AcmeChallenge
+	acmeHTTPChallenge = "http"
+	acmeDNSChallenge  = "dns"
+	// externalProxyHTTPPort and externalProxyHTTPSPort are the localhost ports Traefik is
+	// published on with --no-bind-web-ports
+	externalProxyHTTPPort  = 8880
+	externalProxyHTTPSPort = 8443
+	// letsEncryptProduction and letsEncryptStaging are the ACME directories of Let's Encrypt.
+	// Staging certificates are not trusted by browsers but have much higher rate limits.
+	letsEncryptProduction = "https://acme-v02.api.letsencrypt.org/directory"
+	letsEncryptStaging    = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	// defaultRegistry hosts the upstream images
+	defaultRegistry = "docker.io"
+	// defaultSecretLength is the length of the generated server secret
+	defaultSecretLength = 32
+	// minSecretLength is the shortest secret --secret-length accepts
+	minSecretLength = 16
+	// defaultSecretCharset is the alphabet of the generated server secret
+	defaultSecretCharset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+)
 
-	var seededRand *rand.Rand = rand.New(
-		rand.NewSource(time.Now().UnixNano()))
+// serverSecret returns the secret from PANGOLIN_SECRET, or a newly generated one if it is not set
+func serverSecret() (string, error) {
+	if secret, ok := os.LookupEnv(secretEnv); ok {
+		if len(secret) < minSecretLength {
+			return "", fmt.Errorf("%s must be at least %d characters long", secretEnv, minSecretLength)
+		}
+		logInfo("Using the server secret from %s", secretEnv)
+		return secret, nil
+	}
+	return generateRandomSecretKey(*secretLengthFlag, defaultSecretCharset), nil
+}
 
-	b := make([]byte, length)
-	for i := range b {
-		b[i] = charset[seededRand.Intn(len(charset))]
+// generateRandomSecretKey returns a random string of length characters drawn from charset,
+// which must not have more than 256 characters
+func generateRandomSecretKey(length int, charset string) string {
+	// Reject bytes above the largest multiple of len(charset) so every character is equally likely
+	maxByte := 256 - (256 % len(charset))
+
+	b := make([]byte, 0, length)
+	buf := make([]byte, length)
+	for len(b) < length {
+		if _, err := rand.Read(buf); err != nil {
+			logError("Error generating secret key: %v", err)
+			exit(1)
+		}
+		for _, v := range buf {
+			if int(v) >= maxByte || len(b) == length {
+				continue
+			}
+			b = append(b, charset[int(v)%len(charset)])
+		}
 	}
 	return string(b)
 }
@@ -618,32 +1462,97 @@ func getPublicIP() string {
 
 // Run external commands with stdio/stderr attached.
 func run(name string, args ...string) error {
-	cmd := exec.Command(name, args...)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	cmd := newCommand(ctx, name, args...)
+	cmd.Stdout, cmd.Stderr = commandOutput()
+	return runCommandContext(ctx, cmd)
 }
 
-func checkPortsAvailable(port int) error {
-	addr := fmt.Sprintf(":%d", port)
-	ln, err := net.Listen("tcp", addr)
+// portFamilies are the address families every port check binds on, so a listener
+// on only IPv4 or only IPv6 is noticed as well
+var portFamilies = []string{"tcp4", "tcp6"}
+
+// checkPortFamily tries to listen on port with the given family. A family the host
+// does not support, like tcp6 with IPv6 disabled, counts as available.
+func checkPortFamily(family string, port int) error {
+	ln, err := net.Listen(family, fmt.Sprintf(":%d", port))
 	if err != nil {
-		return fmt.Errorf(
-			"ERROR: port %d is occupied or cannot be bound: %w\n\n",
-			port, err,
-		)
+		if errors.Is(err, syscall.EAFNOSUPPORT) || errors.Is(err, syscall.EADDRNOTAVAIL) {
+			return nil
+		}
+		return err
 	}
 	if closeErr := ln.Close(); closeErr != nil {
-		fmt.Fprintf(os.Stderr,
-			"WARNING: failed to close test listener on port %d: %v\n",
-			port, closeErr,
-		)
+		logWarn("Warning: failed to close test listener on port %d: %v", port, closeErr)
 	}
 	return nil
 }
 
+// occupiedPort is a port another process listens on, with the families it occupies
+type occupiedPort struct {
+	Port     int
+	Families []string
+}
+
+// checkRequiredPorts returns the Traefik ports that another process is already listening on.
+// Ports that cannot be bound for other reasons, e.g. missing privileges, are not reported.
+func checkRequiredPorts(ports []int) []occupiedPort {
+	var occupied []occupiedPort
+	for _, port := range ports {
+		var families []string
+		for _, family := range portFamilies {
+			if err := checkPortFamily(family, port); err != nil && errors.Is(err, syscall.EADDRINUSE) {
+				families = append(families, family)
+			}
+		}
+		if len(families) > 0 {
+			occupied = append(occupied, occupiedPort{Port: port, Families: families})
+		}
+	}
+	return occupied
+}
+
+// portOwner returns a description of the process listening on port, or "" if ss and lsof
+// are unavailable or do not know
+func portOwner(port int) string {
+	if _, err := exec.LookPath("ss"); err == nil {
+		out, err := exec.Command("ss", "-Hltnp", fmt.Sprintf("sport = :%d", port)).Output()
+		if err == nil {
+			// users:(("nginx",pid=1234,fd=6),...)
+			if i := strings.Index(string(out), "users:(("); i >= 0 {
+				owner := string(out)[i+len("users:(("):]
+				if end := strings.Index(owner, ")"); end >= 0 {
+					owner = owner[:end]
+				}
+				return strings.ReplaceAll(owner, "\"", "")
+			}
+		}
+	}
+
+	if _, err := exec.LookPath("lsof"); err == nil {
+		out, err := exec.Command("lsof", "-nP", fmt.Sprintf("-iTCP:%d", port), "-sTCP:LISTEN", "-Fcp").Output()
+		if err == nil {
+			var pid, command string
+			for _, line := range strings.Split(string(out), "\n") {
+				if strings.HasPrefix(line, "p") && pid == "" {
+					pid = line[1:]
+				} else if strings.HasPrefix(line, "c") && command == "" {
+					command = line[1:]
+				}
+			}
+			if command != "" {
+				return fmt.Sprintf("%s,pid=%s", command, pid)
+			}
+		}
+	}
+
+	return ""
+}
+
 func downloadMaxMindDatabase() error {
-	fmt.Println("Downloading MaxMind GeoLite2 Country database...")
+	logInfo("Downloading MaxMind GeoLite2 Country database...")
 	
 	// Download the GeoLite2 Country database
 	if err := run("curl", "-L", "-o", "GeoLite2-Country.tar.gz", 
@@ -663,9 +1572,9 @@ func downloadMaxMindDatabase() error {
 	
 	// Clean up the downloaded files
 	if err := run("rm", "-rf", "GeoLite2-Country.tar.gz", "GeoLite2-Country_*"); err != nil {
-		fmt.Printf("Warning: failed to clean up temporary files: %v\n", err)
+		logWarn("Warning: failed to clean up temporary files: %v", err)
 	}
 	
-	fmt.Println("MaxMind GeoLite2 Country database downloaded successfully!")
+	logInfo("MaxMind GeoLite2 Country database downloaded successfully!")
 	return nil
 }
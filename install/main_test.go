@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestGenerateRandomSecretKey(t *testing.T) {
+	tests := []struct {
+		name    string
+		length  int
+		charset string
+		// flagValid is whether validateFlags accepts length as --secret-length
+		flagValid bool
+	}{
+		{"default", defaultSecretLength, defaultSecretCharset, true},
+		{"below minimum", minSecretLength - 1, defaultSecretCharset, false},
+		{"minimum", minSecretLength, defaultSecretCharset, true},
+		{"long", 128, defaultSecretCharset, true},
+		{"custom charset", 64, "abc123", true},
+		{"single character", minSecretLength, "x", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*secretLengthFlag = tt.length
+			t.Cleanup(func() { *secretLengthFlag = defaultSecretLength })
+			if err := validateFlags(); (err == nil) != tt.flagValid {
+				t.Errorf("validateFlags with --secret-length %d = %v, want valid %v", tt.length, err, tt.flagValid)
+			}
+			if !tt.flagValid {
+				return
+			}
+
+			key := generateRandomSecretKey(tt.length, tt.charset)
+			if len(key) != tt.length {
+				t.Errorf("got a key of length %d, want %d", len(key), tt.length)
+			}
+			for _, c := range key {
+				if !strings.ContainsRune(tt.charset, c) {
+					t.Errorf("key %q contains %q, which is not in the charset %q", key, c, tt.charset)
+				}
+			}
+			if len(tt.charset) > 1 && generateRandomSecretKey(tt.length, tt.charset) == key {
+				t.Errorf("two calls returned the same key %q", key)
+			}
+		})
+	}
+}
+
+func TestRenderConfigFilesKeepsExistingSecret(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	config := defaultConfig()
+	config.BaseDomain = "example.com"
+	config.DashboardDomain = "pangolin.example.com"
+	config.LetsEncryptEmail = "admin@example.com"
+	config.Secret = generateRandomSecretKey(defaultSecretLength, defaultSecretCharset)
+	if err := renderConfigFiles(config, "."); err != nil {
+		t.Fatalf("first render: %v", err)
+	}
+
+	// A re-run reads the secret back from the installation instead of generating one
+	rerun := config
+	secret, err := installedSecret()
+	if err != nil {
+		t.Fatalf("installedSecret: %v", err)
+	}
+	rerun.Secret = secret
+	if err := renderConfigFiles(rerun, "."); err != nil {
+		t.Fatalf("second render: %v", err)
+	}
+
+	got, err := installedSecret()
+	if err != nil {
+		t.Fatalf("installedSecret: %v", err)
+	}
+	if got != config.Secret {
+		t.Errorf("server.secret = %q after re-rendering, want %q", got, config.Secret)
+	}
+}
+
+func TestMoveFileAcrossDevices(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.yml")
+	dst := filepath.Join(dir, "dst.yml")
+	if err := os.WriteFile(src, []byte("services: {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// WriteFile applies the umask, so set the mode explicitly
+	if err := os.Chmod(src, 0640); err != nil {
+		t.Fatal(err)
+	}
+
+	renameFile = func(oldpath, newpath string) error {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EXDEV}
+	}
+	t.Cleanup(func() { renameFile = os.Rename })
+
+	if err := moveFile(src, dst); err != nil {
+		t.Fatalf("moveFile: %v", err)
+	}
+
+	if _, err := os.Stat(src); !os.IsNotExist(err) {
+		t.Errorf("%s still exists after the move: %v", src, err)
+	}
+	content, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "services: {}\n" {
+		t.Errorf("moved content = %q", content)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("moved file has mode %v, want %v", info.Mode().Perm(), os.FileMode(0640))
+	}
+}
+
+func TestMoveFileRenameError(t *testing.T) {
+	dir := t.TempDir()
+	err := moveFile(filepath.Join(dir, "missing.yml"), filepath.Join(dir, "dst.yml"))
+	if !os.IsNotExist(err) {
+		t.Errorf("moveFile of a missing file = %v, want a not exist error without the copy fallback", err)
+	}
+}
+
+func TestServerSecretFromEnv(t *testing.T) {
+	tests := []struct {
+		secret  string
+		wantErr bool
+	}{
+		{strings.Repeat("s", minSecretLength-1), true},
+		{strings.Repeat("s", minSecretLength), false},
+		{"a-long-secret-passed-in-the-environment", false},
+	}
+
+	for _, tt := range tests {
+		t.Setenv(secretEnv, tt.secret)
+		secret, err := serverSecret()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("serverSecret accepted the %d character %s", len(tt.secret), secretEnv)
+			}
+			continue
+		}
+		if err != nil || secret != tt.secret {
+			t.Errorf("serverSecret() = %q, %v, want %q from %s", secret, err, tt.secret, secretEnv)
+		}
+	}
+}
+
+func TestCollectEmailConfigSkipsPasswordPromptWithEnv(t *testing.T) {
+	t.Setenv(smtpPassEnv, "from-env")
+
+	// Read as the password prompt, the no-reply answer would be taken as the password
+	// and the second copy would answer the no-reply prompt instead
+	input := "smtp.company.io\n587\nmailer\nnoreply@company.io\nno\nnoreply@company.io\nno\n"
+	reader := bufio.NewReader(strings.NewReader(input))
+	config := defaultConfig()
+	collectEmailConfig(reader, &config)
+
+	if config.EmailSMTPPass != "from-env" {
+		t.Errorf("SMTP password = %q, want %q from %s", config.EmailSMTPPass, "from-env", smtpPassEnv)
+	}
+	if config.EmailNoReply != "noreply@company.io" || config.EmailSMTPUser != "mailer" {
+		t.Errorf("got user %q and no-reply %q, the prompts read the wrong answers", config.EmailSMTPUser, config.EmailNoReply)
+	}
+}
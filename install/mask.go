@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// maskSecret hides a secret for printing, keeping the first and last two characters of
+// longer values so they can still be told apart. The mask never reveals the length.
+func maskSecret(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	runes := []rune(value)
+	if len(runes) < 12 {
+		return "********"
+	}
+	return string(runes[:2]) + "****" + string(runes[len(runes)-2:])
+}
+
+// secretValues returns the secrets of config that must never be printed
+func secretValues(config Config) []string {
+	secrets := []string{config.Secret, config.EmailSMTPPass, config.TraefikBouncerKey, config.DNSAPIToken}
+	if config.DbBackend == dbBackendPostgres {
+		// The password is URL-escaped inside the connection string
+		secrets = append(secrets, config.PostgresPass, config.PostgresConnectionString())
+	}
+	return secrets
+}
+
+// maskSecrets replaces every occurrence of the secrets in text with its masked form.
+// Longer secrets are replaced first, so a secret containing another one stays hidden.
+func maskSecrets(text string, secrets []string) string {
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	for _, secret := range sorted {
+		// Very short values would mask unrelated text
+		if len(secret) < 4 {
+			continue
+		}
+		text = strings.ReplaceAll(text, secret, maskSecret(secret))
+	}
+	return text
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestMaskSecret(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", "(not set)"},
+		{"a", "********"},
+		{"hunter2", "********"},
+		{"elevenchars", "********"},
+		{"twelvechars!", "tw****s!"},
+		{"aVeryLongServerSecretOf32Chars!!", "aV****!!"},
+		{"pässwörtchen€€", "pä****€€"},
+	}
+
+	for _, tt := range tests {
+		if got := maskSecret(tt.value); got != tt.want {
+			t.Errorf("maskSecret(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// dataDirectories are the directories the containers write to, with the service writing them
+var dataDirectories = []struct {
+	Path    string
+	Service string
+}{
+	{"config/db", "pangolin"},
+	{"config/logs", "pangolin"},
+	{"config/letsencrypt", "traefik"},
+	{"config/traefik/logs", "traefik"},
+	{"config/crowdsec/db", "crowdsec"},
+}
+
+// acmeFile is the certificate store of Traefik, which refuses to use it unless only its owner can read it
+const acmeFile = "config/letsencrypt/acme.json"
+
+// permissionChange is one chown or chmod repairPermissions makes
+type permissionChange struct {
+	Path  string
+	Chown bool
+	UID   int
+	GID   int
+	Mode  fs.FileMode
+}
+
+// serviceUser returns the numeric user and group a compose service runs as. Services without
+// a user run as the root user of their image.
+func serviceUser(service interface{}) (uid int, gid int, err error) {
+	settings, _ := service.(map[string]interface{})
+	user := fmt.Sprint(settings["user"])
+	if settings["user"] == nil || user == "" {
+		return 0, 0, nil
+	}
+
+	owner, group, found := strings.Cut(user, ":")
+	if uid, err = strconv.Atoi(owner); err != nil {
+		return 0, 0, fmt.Errorf("the user %q is not numeric", user)
+	}
+	gid = uid
+	if found {
+		if gid, err = strconv.Atoi(group); err != nil {
+			return 0, 0, fmt.Errorf("the group %q is not numeric", user)
+		}
+	}
+	return uid, gid, nil
+}
+
+// planPermissionChanges lists the changes that give every data directory to the user of its
+// service, keep it writable for that user and restrict acme.json to its owner
+func planPermissionChanges(services map[string]interface{}) ([]permissionChange, error) {
+	var changes []permissionChange
+	for _, dir := range dataDirectories {
+		service, ok := services[dir.Service]
+		if !ok {
+			continue
+		}
+		if _, err := os.Lstat(dir.Path); os.IsNotExist(err) {
+			continue
+		}
+		uid, gid, err := serviceUser(service)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v, fix the ownership of %s by hand", dir.Service, err, dir.Path)
+		}
+
+		err = filepath.WalkDir(dir.Path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			// Links are not followed, their targets may be outside of config/
+			if info.Mode()&fs.ModeSymlink != 0 {
+				return nil
+			}
+
+			change := permissionChange{Path: path, UID: uid, GID: gid, Mode: info.Mode().Perm()}
+			if owner, group, ok := fileOwner(info); ok && (owner != uid || group != gid) {
+				change.Chown = true
+			}
+			switch {
+			case path == acmeFile:
+				change.Mode = 0600
+			case d.IsDir():
+				change.Mode |= 0700
+			default:
+				change.Mode |= 0600
+			}
+			if change.Chown || change.Mode != info.Mode().Perm() {
+				changes = append(changes, change)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to inspect %s: %v", dir.Path, err)
+		}
+	}
+	return changes, nil
+}
+
+// repairPermissions fixes the ownership and modes of the data directories, printing every change.
+// It refuses to start when files need a new owner and the installer is not running as root.
+func repairPermissions() error {
+	services, err := readComposeServices(*composeFileFlag)
+	if err != nil {
+		return fmt.Errorf("%v, run this from the installation directory", err)
+	}
+
+	changes, err := planPermissionChanges(services)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		logInfo("The data directories already have the expected owners and modes.")
+		return nil
+	}
+
+	chowns := 0
+	for _, change := range changes {
+		if change.Chown {
+			chowns++
+		}
+	}
+	if chowns > 0 && os.Geteuid() != 0 {
+		return fmt.Errorf("%d file(s) need a new owner, rerun --repair-permissions as root", chowns)
+	}
+
+	for _, change := range changes {
+		if change.Chown {
+			if err := os.Lchown(change.Path, change.UID, change.GID); err != nil {
+				return fmt.Errorf("failed to change the owner of %s: %v", change.Path, err)
+			}
+			logInfo("  chown %d:%d %s", change.UID, change.GID, change.Path)
+		}
+		info, err := os.Lstat(change.Path)
+		if err != nil {
+			return err
+		}
+		if info.Mode().Perm() != change.Mode {
+			if err := os.Chmod(change.Path, change.Mode); err != nil {
+				return fmt.Errorf("failed to change the mode of %s: %v", change.Path, err)
+			}
+			logInfo("  chmod %o %s", change.Mode, change.Path)
+		}
+	}
+	logInfo("Repaired the permissions of %d file(s), restart the stack with --restart if the containers failed on them.", len(changes))
+	return nil
+}
@@ -0,0 +1,85 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// aptLockFiles are locked with fcntl by apt, dpkg and unattended-upgrades while they run
+var aptLockFiles = []string{"/var/lib/dpkg/lock-frontend", "/var/lib/dpkg/lock", "/var/lib/apt/lists/lock"}
+
+// packageManagerProcesses are the package managers that only allow one instance at a time
+var packageManagerProcesses = map[string][]string{
+	"fedora":   {"dnf", "dnf5", "yum"},
+	"rhel":     {"dnf", "dnf5", "yum"},
+	"amzn":     {"dnf", "yum"},
+	"opensuse": {"zypper"},
+	"arch":     {"pacman"},
+	"alpine":   {"apk"},
+}
+
+// packageManagerBusy returns a description of whatever holds the package manager lock of
+// the distribution, or "" if it is free
+func packageManagerBusy(distroID string) string {
+	switch distroID {
+	case "ubuntu", "debian", "raspbian":
+		for _, path := range aptLockFiles {
+			if pid := fcntlLockHolder(path); pid > 0 {
+				return fmt.Sprintf("%s is locked by %s (pid %d)", path, processName(pid), pid)
+			}
+		}
+		return ""
+	}
+
+	if strings.HasPrefix(distroID, "opensuse") {
+		distroID = "opensuse"
+	}
+	names := packageManagerProcesses[distroID]
+	if len(names) == 0 {
+		return ""
+	}
+	dirs, _ := filepath.Glob("/proc/[0-9]*")
+	for _, dir := range dirs {
+		pid, err := strconv.Atoi(filepath.Base(dir))
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		name := processName(pid)
+		for _, candidate := range names {
+			if name == candidate {
+				return fmt.Sprintf("%s is already running (pid %d)", name, pid)
+			}
+		}
+	}
+	return ""
+}
+
+// fcntlLockHolder returns the pid holding an fcntl lock on path, or 0
+func fcntlLockHolder(path string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+
+	lock := syscall.Flock_t{Type: syscall.F_WRLCK}
+	if err := syscall.FcntlFlock(file.Fd(), syscall.F_GETLK, &lock); err != nil || lock.Type == syscall.F_UNLCK {
+		return 0
+	}
+	return int(lock.Pid)
+}
+
+// processName returns the command name of pid from /proc
+func processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(comm))
+}
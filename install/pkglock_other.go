@@ -0,0 +1,8 @@
+//go:build !linux
+
+package main
+
+// packageManagerBusy is only implemented on Linux, where installDocker runs
+func packageManagerBusy(distroID string) string {
+	return ""
+}
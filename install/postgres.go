@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// dbBackendSQLite and dbBackendPostgres are the values of Config.DbBackend
+	dbBackendSQLite   = "sqlite"
+	dbBackendPostgres = "postgres"
+
+	// postgresDialTimeout bounds the reachability check of the PostgreSQL server
+	postgresDialTimeout = 5 * time.Second
+
+	// sqliteDatabase is where Pangolin keeps its SQLite database
+	sqliteDatabase = "config/db/db.sqlite"
+)
+
+// PostgresConnectionString returns the connection string Pangolin uses for an external PostgreSQL
+func (c Config) PostgresConnectionString() string {
+	u := url.URL{
+		Scheme: "postgresql",
+		User:   url.UserPassword(c.PostgresUser, c.PostgresPass),
+		Host:   net.JoinHostPort(c.PostgresHost, strconv.Itoa(c.PostgresPort)),
+		Path:   "/" + c.PostgresDB,
+	}
+	return u.String()
+}
+
+// PangolinImageTag returns the tag of the Pangolin image, which has a separate PostgreSQL build
+func (c Config) PangolinImageTag() string {
+	if c.DbBackend == dbBackendPostgres {
+		return "postgresql-" + c.PangolinVersion
+	}
+	return c.PangolinVersion
+}
+
+// validatePostgresConfig checks that the PostgreSQL settings are complete
+func validatePostgresConfig(config Config) error {
+	var missing []string
+	if config.PostgresHost == "" {
+		missing = append(missing, "host")
+	}
+	if config.PostgresUser == "" {
+		missing = append(missing, "user")
+	}
+	if config.PostgresDB == "" {
+		missing = append(missing, "database name")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("the PostgreSQL %s must be set", strings.Join(missing, ", "))
+	}
+	if config.PostgresPort < 1 || config.PostgresPort > 65535 {
+		return fmt.Errorf("the PostgreSQL port %d is not between 1 and 65535", config.PostgresPort)
+	}
+	return nil
+}
+
+// collectPostgresConfig asks for the connection settings of an external PostgreSQL server
+func collectPostgresConfig(reader *bufio.Reader, config *Config) {
+	config.PostgresHost = readValidatedString(reader, "Enter the PostgreSQL host", config.PostgresHost, func(value string) (bool, string) {
+		if value == "" {
+			return false, "a host is required"
+		}
+		return true, ""
+	})
+	config.PostgresPort = readIntInRange(reader, "Enter the PostgreSQL port", config.PostgresPort, 1, 65535)
+	config.PostgresUser = readString(reader, "Enter the PostgreSQL user", config.PostgresUser)
+	if pass, ok := os.LookupEnv(postgresPassEnv); ok {
+		logInfo("Using the PostgreSQL password from %s", postgresPassEnv)
+		config.PostgresPass = pass
+	} else {
+		config.PostgresPass = readPassword("Enter the PostgreSQL password", reader)
+	}
+	config.PostgresDB = readString(reader, "Enter the PostgreSQL database name", "pangolin")
+}
+
+// checkPostgresReachable makes sure the PostgreSQL server accepts TCP connections. Hosts
+// only resolvable inside the container network cannot be checked from here.
+func checkPostgresReachable(config Config) error {
+	addr := net.JoinHostPort(config.PostgresHost, strconv.Itoa(config.PostgresPort))
+	conn, err := net.DialTimeout("tcp", addr, postgresDialTimeout)
+	if err != nil {
+		return fmt.Errorf("could not connect to PostgreSQL at %s: %v", addr, err)
+	}
+	conn.Close()
+	return nil
+}
+
+// parsePostgresConnectionString fills the PostgreSQL settings of config from a connection string
+func parsePostgresConnectionString(value string, config *Config) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "postgresql" && u.Scheme != "postgres") {
+		return fmt.Errorf("invalid PostgreSQL connection string")
+	}
+
+	config.DbBackend = dbBackendPostgres
+	config.PostgresHost = u.Hostname()
+	config.PostgresPort = 5432
+	if port := u.Port(); port != "" {
+		if config.PostgresPort, err = strconv.Atoi(port); err != nil {
+			return fmt.Errorf("invalid PostgreSQL port %q", port)
+		}
+	}
+	config.PostgresUser = u.User.Username()
+	config.PostgresPass, _ = u.User.Password()
+	config.PostgresDB = strings.TrimPrefix(u.Path, "/")
+	return nil
+}
+
+// checkDatabaseBackend warns that an existing SQLite database is not moved to PostgreSQL and
+// makes sure the PostgreSQL server can be reached before the configuration is written
+func checkDatabaseBackend(reader *bufio.Reader, config Config) {
+	if config.DbBackend != dbBackendPostgres {
+		return
+	}
+	if _, err := os.Stat(sqliteDatabase); err == nil {
+		logWarn("Warning: the data in %s is not migrated, Pangolin starts with an empty PostgreSQL database.", sqliteDatabase)
+	}
+	if err := checkPostgresReachable(config); err != nil {
+		logWarn("Warning: %v", err)
+		if !confirm(reader, "ignore-db-unreachable", "Continue with this PostgreSQL server anyway?", false) {
+			exit(1)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// profilesDir holds the named copies of the generated configuration
+const profilesDir = "profiles"
+
+// activeProfileFile records which profile is currently in place
+var activeProfileFile = filepath.Join(profilesDir, ".active")
+
+// profileFile is a generated file of a saved configuration, with its path inside the profile
+// and on the host
+type profileFile struct {
+	Saved string
+	Live  string
+}
+
+// profileFiles returns the generated files that make up a saved configuration. The compose
+// file is saved as docker-compose.yml wherever --compose-file keeps it.
+func profileFiles() []profileFile {
+	return []profileFile{
+		{"docker-compose.yml", *composeFileFlag},
+		{"config/config.yml", "config/config.yml"},
+		{"config/traefik/traefik_config.yml", "config/traefik/traefik_config.yml"},
+		{"config/traefik/dynamic_config.yml", "config/traefik/dynamic_config.yml"},
+		{dnsEnvFile, dnsEnvFile},
+	}
+}
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// validateProfileName rejects names that are not a single directory below profilesDir
+func validateProfileName(name string) error {
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid profile name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// saveProfile stores a named copy of the current configuration files
+func saveProfile(name string, report *Report) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	if _, err := os.Stat("config/config.yml"); err != nil {
+		return fmt.Errorf("no configuration found to save, run the installer first")
+	}
+
+	if err := storeProfile(filepath.Join(profilesDir, name)); err != nil {
+		return err
+	}
+	if err := os.WriteFile(activeProfileFile, []byte(name+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to record active profile: %v", err)
+	}
+
+	report.Message = fmt.Sprintf("Saved current configuration as profile %q", name)
+	return nil
+}
+
+// storeProfile copies the current configuration files into profilePath. They hold the server
+// secret and the SMTP and DNS credentials, so only the owner may read the profiles.
+func storeProfile(profilePath string) error {
+	if err := os.MkdirAll(profilesDir, 0700); err != nil {
+		return fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	// Tighten a profiles directory created by an older installer
+	if err := os.Chmod(profilesDir, 0700); err != nil {
+		return fmt.Errorf("failed to restrict %s: %v", profilesDir, err)
+	}
+
+	for _, file := range profileFiles() {
+		if _, err := os.Stat(file.Live); err != nil {
+			continue
+		}
+		dest := filepath.Join(profilePath, file.Saved)
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return fmt.Errorf("failed to create profile directory: %v", err)
+		}
+		if err := copyFile(file.Live, dest); err != nil {
+			return fmt.Errorf("failed to save %s: %v", file.Live, err)
+		}
+		if err := os.Chmod(dest, 0600); err != nil {
+			return fmt.Errorf("failed to restrict %s: %v", dest, err)
+		}
+	}
+	return nil
+}
+
+// liveFileMode returns the mode a restored file gets, the profiles keep every file private
+func liveFileMode(path string) os.FileMode {
+	if privateConfigFiles[path] {
+		return 0600
+	}
+	return 0644
+}
+
+// savedProfileMatches reports whether the profile holds exactly the current configuration files
+func savedProfileMatches(name string) bool {
+	for _, file := range profileFiles() {
+		live, liveErr := os.ReadFile(file.Live)
+		saved, savedErr := os.ReadFile(filepath.Join(profilesDir, name, file.Saved))
+		if os.IsNotExist(liveErr) && os.IsNotExist(savedErr) {
+			continue
+		}
+		if liveErr != nil || savedErr != nil || !bytes.Equal(live, saved) {
+			return false
+		}
+	}
+	return true
+}
+
+// currentConfigSaved reports whether switching away from the current configuration loses
+// nothing, because there is none or a saved profile holds it unchanged
+func currentConfigSaved() (bool, error) {
+	if _, err := os.Stat("config/config.yml"); os.IsNotExist(err) {
+		return true, nil
+	}
+	if active := activeProfile(); active != "" && savedProfileMatches(active) {
+		return true, nil
+	}
+
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read profiles: %v", err)
+	}
+	for _, entry := range entries {
+		if entry.IsDir() && savedProfileMatches(entry.Name()) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// useProfile copies a saved profile's files back into place. A current configuration that no
+// profile holds, e.g. one never saved or edited since, is saved as unsaved-<timestamp> first,
+// so its secrets are not lost.
+func useProfile(name string, report *Report) error {
+	if err := validateProfileName(name); err != nil {
+		return err
+	}
+	profilePath := filepath.Join(profilesDir, name)
+	if _, err := os.Stat(filepath.Join(profilePath, "config/config.yml")); err != nil {
+		return fmt.Errorf("profile %q does not exist", name)
+	}
+
+	active := activeProfile()
+	if active == name && savedProfileMatches(name) {
+		report.Message = fmt.Sprintf("Profile %q is already active", name)
+		return nil
+	}
+	if isStackRunning() {
+		if active == "" {
+			active = "unsaved"
+		}
+		return fmt.Errorf("containers from the %s profile are running, stop them before switching profiles", active)
+	}
+
+	saved, err := currentConfigSaved()
+	if err != nil {
+		return err
+	}
+	if !saved {
+		unsaved := "unsaved-" + time.Now().Format("20060102-150405")
+		if err := storeProfile(filepath.Join(profilesDir, unsaved)); err != nil {
+			return fmt.Errorf("refusing to switch, the current configuration could not be saved: %v", err)
+		}
+		report.Warn("the current configuration was not saved in a profile, it was kept as profile %q", unsaved)
+	}
+
+	for _, file := range profileFiles() {
+		src := filepath.Join(profilePath, file.Saved)
+		if _, err := os.Stat(src); err != nil {
+			// A profile without DNS credentials must not run with those of the previous one
+			if file.Live == dnsEnvFile {
+				if err := os.Remove(file.Live); err != nil && !os.IsNotExist(err) {
+					return fmt.Errorf("failed to remove %s: %v", file.Live, err)
+				}
+			}
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(file.Live), 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %v", file.Live, err)
+		}
+		if err := copyFile(src, file.Live); err != nil {
+			return fmt.Errorf("failed to restore %s: %v", file.Live, err)
+		}
+		if err := os.Chmod(file.Live, liveFileMode(file.Live)); err != nil {
+			return fmt.Errorf("failed to set the mode of %s: %v", file.Live, err)
+		}
+	}
+
+	if err := os.WriteFile(activeProfileFile, []byte(name+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to record active profile: %v", err)
+	}
+
+	report.Message = fmt.Sprintf("Switched to profile %q", name)
+	report.Warn("config/db and config/letsencrypt are shared by all profiles, the database and certificates were not switched")
+	return nil
+}
+
+// listProfiles prints the saved profiles and marks the active one
+func listProfiles(report *Report) error {
+	entries, err := os.ReadDir(profilesDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read profiles: %v", err)
+	}
+
+	active := activeProfile()
+	report.Columns = []string{"profile", "active"}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		report.AddRow(entry.Name(), fmt.Sprint(entry.Name() == active))
+	}
+
+	if len(report.Rows) == 0 {
+		report.Message = "No saved profiles."
+	}
+	return nil
+}
+
+// activeProfile returns the name of the active profile or an empty string
+func activeProfile() string {
+	content, err := os.ReadFile(activeProfileFile)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(content))
+}
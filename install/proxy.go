@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+)
+
+// proxyVariables are the proxy settings passed on to the package managers and container runtimes
+var proxyVariables = []string{"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY"}
+
+// applyProxySettings sets the proxy variables from --http-proxy, --https-proxy and --no-proxy and
+// exports every proxy variable in both spellings. apt, curl and dnf disagree on whether they read
+// http_proxy or HTTP_PROXY, and child commands inherit the environment of the installer.
+func applyProxySettings() {
+	flags := map[string]*string{
+		"HTTP_PROXY":  httpProxyFlag,
+		"HTTPS_PROXY": httpsProxyFlag,
+		"NO_PROXY":    noProxyFlag,
+	}
+
+	for _, name := range proxyVariables {
+		value := *flags[name]
+		if value == "" {
+			value = os.Getenv(name)
+		}
+		if value == "" {
+			value = os.Getenv(strings.ToLower(name))
+		}
+		if value == "" {
+			continue
+		}
+		os.Setenv(name, value)
+		os.Setenv(strings.ToLower(name), value)
+	}
+}
+
+// proxyConfigured reports whether an HTTP or HTTPS proxy is set for this run
+func proxyConfigured() bool {
+	return os.Getenv("HTTP_PROXY") != "" || os.Getenv("HTTPS_PROXY") != ""
+}
+
+// warnDockerDaemonProxy warns when a proxy is set but the Docker daemon has none. The daemon
+// pulls the images itself and does not see the environment of the installer. Podman pulls
+// in the calling process, so it uses the exported variables directly.
+func warnDockerDaemonProxy(containerType SupportedContainer) {
+	if containerType != Docker || !proxyConfigured() {
+		return
+	}
+
+	ctx, cancel := commandContext()
+	defer cancel()
+
+	cmd := newCommand(ctx, "docker", "info", "--format", "{{.HTTPProxy}}{{.HTTPSProxy}}")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := runCommandContext(ctx, cmd); err != nil || strings.TrimSpace(out.String()) != "" {
+		return
+	}
+
+	logWarn("Warning: a proxy is set but the Docker daemon is not configured to use one, so pulling the images may fail.")
+	logInfo("Add the proxy to /etc/docker/daemon.json, for example:")
+	logInfo(`  {"proxies": {"http-proxy": %q, "https-proxy": %q, "no-proxy": %q}}`, os.Getenv("HTTP_PROXY"), os.Getenv("HTTPS_PROXY"), os.Getenv("NO_PROXY"))
+	logInfo("and restart Docker with: systemctl restart docker")
+}
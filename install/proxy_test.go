@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestApplyProxySettingsReachesCommands(t *testing.T) {
+	tests := []struct {
+		name  string
+		flags map[string]string
+		env   map[string]string
+	}{
+		{
+			name:  "from flags",
+			flags: map[string]string{"HTTP_PROXY": "http://proxy:3128", "HTTPS_PROXY": "http://proxy:3129", "NO_PROXY": "localhost,10.0.0.0/8"},
+		},
+		{
+			name: "from lowercase environment",
+			env:  map[string]string{"http_proxy": "http://proxy:3128", "https_proxy": "http://proxy:3129", "no_proxy": "localhost,10.0.0.0/8"},
+		},
+	}
+	want := map[string]string{"HTTP_PROXY": "http://proxy:3128", "HTTPS_PROXY": "http://proxy:3129", "NO_PROXY": "localhost,10.0.0.0/8"}
+	flags := map[string]*string{"HTTP_PROXY": httpProxyFlag, "HTTPS_PROXY": httpsProxyFlag, "NO_PROXY": noProxyFlag}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Setenv restores whatever applyProxySettings exports once the test ends
+			for _, name := range proxyVariables {
+				t.Setenv(name, tt.env[name])
+				t.Setenv(strings.ToLower(name), tt.env[strings.ToLower(name)])
+				*flags[name] = tt.flags[name]
+			}
+			t.Cleanup(func() {
+				for _, name := range proxyVariables {
+					*flags[name] = ""
+				}
+			})
+
+			applyProxySettings()
+
+			environ := newCommand(context.Background(), "env").Environ()
+			for name, value := range want {
+				for _, variable := range []string{name, strings.ToLower(name)} {
+					if !slices.Contains(environ, variable+"="+value) {
+						t.Errorf("the command environment has no %s=%s", variable, value)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// installedAppConfig holds the config.yml values needed to rebuild a Config
+type installedAppConfig struct {
+	App struct {
+		DashboardURL string `yaml:"dashboard_url"`
+	} `yaml:"app"`
+	Domains map[string]struct {
+		BaseDomain string `yaml:"base_domain"`
+	} `yaml:"domains"`
+	Server struct {
+		Secret        string `yaml:"secret"`
+		MaxmindDBPath string `yaml:"maxmind_db_path"`
+	} `yaml:"server"`
+	Email *struct {
+		SMTPHost string `yaml:"smtp_host"`
+		SMTPPort int    `yaml:"smtp_port"`
+		SMTPUser string `yaml:"smtp_user"`
+		SMTPPass string `yaml:"smtp_pass"`
+		NoReply  string `yaml:"no_reply"`
+	} `yaml:"email"`
+	Postgres *struct {
+		ConnectionString string `yaml:"connection_string"`
+	} `yaml:"postgres"`
+}
+
+// installedTraefikConfig holds the traefik_config.yml values needed to rebuild a Config
+type installedTraefikConfig struct {
+	Log struct {
+		MaxSize    int `yaml:"maxSize"`
+		MaxBackups int `yaml:"maxBackups"`
+		MaxAge     int `yaml:"maxAge"`
+	} `yaml:"log"`
+	EntryPoints map[string]struct {
+		Address string `yaml:"address"`
+	} `yaml:"entryPoints"`
+	CertificatesResolvers struct {
+		LetsEncrypt struct {
+			Acme struct {
+				Email        string `yaml:"email"`
+				CAServer     string `yaml:"caServer"`
+				DNSChallenge *struct {
+					Provider string `yaml:"provider"`
+				} `yaml:"dnsChallenge"`
+			} `yaml:"acme"`
+		} `yaml:"letsencrypt"`
+	} `yaml:"certificatesResolvers"`
+}
+
+// installedDynamicConfig holds the dynamic_config.yml values needed to rebuild a Config
+type installedDynamicConfig struct {
+	HTTP struct {
+		Middlewares map[string]struct {
+			IPAllowList struct {
+				SourceRange []string `yaml:"sourceRange"`
+			} `yaml:"ipAllowList"`
+		} `yaml:"middlewares"`
+	} `yaml:"http"`
+}
+
+// reconcileTargets maps every rendered file to the services that must be restarted when it changes.
+// A changed docker-compose.yml recreates the whole stack.
+var reconcileTargets = map[string][]string{
+	"config/config.yml":                 {"pangolin"},
+	"config/traefik/traefik_config.yml": {"traefik"},
+	"config/traefik/dynamic_config.yml": {"traefik"},
+	"docker-compose.yml":                nil,
+	// Containers only read their env_file when they are created
+	dnsEnvFile: nil,
+}
+
+// regenerateSets are the groups of rendered files --regenerate can write on their own
+var regenerateSets = map[string][]string{
+	"traefik":  {"config/traefik/traefik_config.yml", "config/traefik/dynamic_config.yml"},
+	"pangolin": {"config/config.yml"},
+}
+
+// installedPath returns where the installation keeps a rendered file, the compose file
+// can be moved with --compose-file
+func installedPath(target string) string {
+	if target == "docker-compose.yml" {
+		return *composeFileFlag
+	}
+	return target
+}
+
+// installedDNSToken returns the DNS provider token of an installation from dnsEnvFile, or from
+// the Traefik environment in the compose file where older installers wrote it
+func installedDNSToken(traefik interface{}, env string) string {
+	if content, err := os.ReadFile(dnsEnvFile); err == nil {
+		for _, line := range strings.Split(string(content), "\n") {
+			if value, ok := strings.CutPrefix(strings.TrimSpace(line), env+"="); ok {
+				return value
+			}
+		}
+	}
+	service, _ := traefik.(map[string]interface{})
+	environment, _ := service["environment"].(map[string]interface{})
+	token, _ := environment[env].(string)
+	return token
+}
+
+// readYAMLFile unmarshals a YAML file into out
+func readYAMLFile(path string, out interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("error parsing %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadInstalledConfig rebuilds the Config of an existing installation from its generated files
+func loadInstalledConfig() (Config, error) {
+	config := defaultConfig()
+
+	var app installedAppConfig
+	if err := readYAMLFile("config/config.yml", &app); err != nil {
+		return Config{}, err
+	}
+	config.DashboardDomain = strings.TrimPrefix(app.App.DashboardURL, "https://")
+	if domain, ok := app.Domains["domain1"]; ok {
+		config.BaseDomain = domain.BaseDomain
+	}
+	domains := make(map[string]string)
+	for key, domain := range app.Domains {
+		domains[key] = domain.BaseDomain
+	}
+	config.SiteDomains = installedSiteDomains(domains)
+	config.Secret = app.Server.Secret
+	config.EnableGeoblocking = app.Server.MaxmindDBPath != ""
+	if app.Email != nil {
+		config.EnableEmail = true
+		config.EmailSMTPHost = app.Email.SMTPHost
+		config.EmailSMTPPort = app.Email.SMTPPort
+		config.EmailSMTPUser = app.Email.SMTPUser
+		config.EmailSMTPPass = app.Email.SMTPPass
+		config.EmailNoReply = app.Email.NoReply
+	}
+	if app.Postgres != nil {
+		if err := parsePostgresConnectionString(app.Postgres.ConnectionString, &config); err != nil {
+			return Config{}, fmt.Errorf("config/config.yml: %v", err)
+		}
+	}
+
+	var traefik installedTraefikConfig
+	if err := readYAMLFile("config/traefik/traefik_config.yml", &traefik); err != nil {
+		return Config{}, err
+	}
+	config.LetsEncryptEmail = traefik.CertificatesResolvers.LetsEncrypt.Acme.Email
+	if caServer := traefik.CertificatesResolvers.LetsEncrypt.Acme.CAServer; caServer != letsEncryptProduction {
+		config.AcmeCaServer = caServer
+	}
+	if challenge := traefik.CertificatesResolvers.LetsEncrypt.Acme.DNSChallenge; challenge != nil {
+		config.AcmeChallenge = acmeDNSChallenge
+		config.DNSProvider = challenge.Provider
+	}
+	config.LogMaxSizeMB = traefik.Log.MaxSize
+	config.LogMaxFiles = traefik.Log.MaxBackups
+	config.LogMaxAgeDays = traefik.Log.MaxAge
+	if metrics, ok := traefik.EntryPoints["metrics"]; ok {
+		port, err := strconv.Atoi(strings.TrimPrefix(metrics.Address, ":"))
+		if err != nil {
+			return Config{}, fmt.Errorf("invalid metrics entrypoint address %q", metrics.Address)
+		}
+		config.EnableMetrics = true
+		config.MetricsPort = port
+	}
+
+	var dynamic installedDynamicConfig
+	if err := readYAMLFile("config/traefik/dynamic_config.yml", &dynamic); err != nil {
+		return Config{}, err
+	}
+	if allowlist, ok := dynamic.HTTP.Middlewares["metrics-allowlist"]; ok {
+		config.MetricsAllowedIPs = allowlist.IPAllowList.SourceRange
+	}
+
+	services, err := readComposeServices(*composeFileFlag)
+	if err != nil {
+		return Config{}, err
+	}
+	if _, ok := services["crowdsec"]; ok {
+		return Config{}, fmt.Errorf("reconciling an installation with CrowdSec is not supported, its merged Traefik and compose files would be overwritten")
+	}
+	_, config.InstallGerbil = services["gerbil"]
+	if pangolin, ok := services["pangolin"].(map[string]interface{}); ok {
+		config.AppEntrypoint = stringList(pangolin["entrypoint"])
+		config.AppCommand = stringList(pangolin["command"])
+		config.RegistryPrefix = registryPrefixOf(pangolin["image"])
+	}
+	config.BindAddress, config.ExternalProxy = installedWebPorts(services)
+	config.Timezone = serviceTimezone(services["pangolin"])
+	config.ImageDigests = installedImageDigests(services)
+	if config.AcmeChallenge == acmeDNSChallenge {
+		config.DNSAPIToken = installedDNSToken(services["traefik"], config.DNSTokenEnv())
+	}
+
+	compose, err := os.ReadFile(*composeFileFlag)
+	if err != nil {
+		return Config{}, fmt.Errorf("error reading %s: %w", *composeFileFlag, err)
+	}
+	config.EnableIPv6 = bytes.Contains(compose, []byte("enable_ipv6: true"))
+
+	if config.BaseDomain == "" || config.DashboardDomain == "" || config.Secret == "" {
+		return Config{}, fmt.Errorf("config/config.yml is missing the domains or the server secret")
+	}
+
+	return config, nil
+}
+
+// installedWebPorts returns the host address the HTTPS port of the stack is published on,
+// empty when it is published on all addresses, and whether it is published for an external proxy
+func installedWebPorts(services map[string]interface{}) (bindAddress string, externalProxy bool) {
+	// Without Gerbil, Traefik publishes the ports itself
+	for _, name := range []string{"gerbil", "traefik"} {
+		service, ok := services[name].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, port := range stringList(service["ports"]) {
+			if port == fmt.Sprintf("127.0.0.1:%d:443", externalProxyHTTPSPort) {
+				return "", true
+			}
+			if address, found := strings.CutSuffix(port, ":443:443"); found {
+				return strings.Trim(address, "[]"), false
+			}
+		}
+	}
+	return "", false
+}
+
+// installedSecret returns the server secret of the existing installation
+func installedSecret() (string, error) {
+	var app installedAppConfig
+	if err := readYAMLFile("config/config.yml", &app); err != nil {
+		return "", err
+	}
+	return app.Server.Secret, nil
+}
+
+// registryPrefixOf returns the registry prefix of the Pangolin image, or an
+// empty string when it comes from the default registry
+func registryPrefixOf(image interface{}) string {
+	s, _ := image.(string)
+	prefix, _, found := strings.Cut(s, "/fosrl/pangolin:")
+	if !found || prefix == defaultRegistry {
+		return ""
+	}
+	return prefix
+}
+
+// stringList converts a YAML list of strings, ignoring anything else
+func stringList(value interface{}) []string {
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil
+	}
+	var list []string
+	for _, item := range items {
+		if s, ok := item.(string); ok {
+			list = append(list, s)
+		}
+	}
+	return list
+}
+
+// reconcile re-renders the templates for an existing installation and reports every file
+// whose content would change. With apply set, the changed files are written and the affected
+// services restarted.
+func reconcile(config Config, apply bool) error {
+	dir, err := os.MkdirTemp("", "pangolin-reconcile-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := renderConfigFiles(config, dir); err != nil {
+		return err
+	}
+	if err := os.Rename(filepath.Join(dir, "config/docker-compose.yml"), filepath.Join(dir, "docker-compose.yml")); err != nil {
+		return fmt.Errorf("failed to move docker-compose.yml: %v", err)
+	}
+	if *swarmFlag {
+		if err := convertComposeForSwarm(filepath.Join(dir, "docker-compose.yml")); err != nil {
+			return err
+		}
+	}
+
+	var changed []string
+	for _, target := range slices.Sorted(maps.Keys(reconcileTargets)) {
+		rendered, err := os.ReadFile(filepath.Join(dir, target))
+		if err != nil {
+			return fmt.Errorf("failed to read rendered %s: %v", target, err)
+		}
+		existing, err := os.ReadFile(installedPath(target))
+		if err == nil && bytes.Equal(existing, rendered) {
+			logInfo("  %s: up to date", target)
+			continue
+		}
+		logInfo("  %s: would be updated", target)
+		changed = append(changed, target)
+	}
+
+	if len(changed) == 0 {
+		logInfo("Everything is up to date.")
+		return nil
+	}
+	if !apply {
+		logInfo("Run the installer with --reconcile to apply these changes.")
+		return nil
+	}
+
+	restartAll := false
+	restart := make(map[string]bool)
+	for _, target := range changed {
+		if err := copyFile(filepath.Join(dir, target), installedPath(target)); err != nil {
+			return fmt.Errorf("failed to update %s: %v", target, err)
+		}
+		logInfo("Updated %s", target)
+
+		services := reconcileTargets[target]
+		if services == nil {
+			restartAll = true
+		}
+		for _, service := range services {
+			restart[service] = true
+		}
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		logInfo("Neither Docker nor Podman is installed, restart the containers yourself to apply the changes.")
+		return nil
+	}
+
+	if restartAll {
+		if err := startContainers(containerType); err != nil {
+			return err
+		}
+	} else {
+		for _, service := range []string{"pangolin", "traefik"} {
+			if !restart[service] {
+				continue
+			}
+			logInfo("Restarting %s...", service)
+			if err := restartContainer(service, containerType); err != nil {
+				return err
+			}
+		}
+	}
+
+	logInfo("Waiting for the core services...")
+	return waitForCoreServices(containerType)
+}
+
+// regenerate re-renders only the files of one regenerateSets group from the installed configuration,
+// keeping a .bak copy of each, and offers to restart the services that read them
+func regenerate(set string, reader *bufio.Reader) error {
+	config, err := loadInstalledConfig()
+	if err != nil {
+		return err
+	}
+	if err := applyFlags(&config); err != nil {
+		return err
+	}
+	loadVersions(&config)
+
+	dir, err := os.MkdirTemp("", "pangolin-regenerate-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := renderConfigFiles(config, dir); err != nil {
+		return err
+	}
+
+	var services []string
+	for _, target := range regenerateSets[set] {
+		if _, err := os.Stat(target); err == nil {
+			if err := copyFile(target, target+".bak"); err != nil {
+				return fmt.Errorf("failed to back up %s: %v", target, err)
+			}
+		}
+		if err := copyFile(filepath.Join(dir, target), target); err != nil {
+			return fmt.Errorf("failed to update %s: %v", target, err)
+		}
+		logInfo("Regenerated %s (previous version kept as %s.bak)", target, target)
+
+		for _, service := range reconcileTargets[target] {
+			if !slices.Contains(services, service) {
+				services = append(services, service)
+			}
+		}
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		logInfo("Neither Docker nor Podman is installed, restart %s yourself to apply the changes.", strings.Join(services, ", "))
+		return nil
+	}
+	if !confirm(reader, "restart-services", fmt.Sprintf("Restart %s now to apply the changes?", strings.Join(services, ", ")), true) {
+		logInfo("Restart %s later to apply the changes.", strings.Join(services, ", "))
+		return nil
+	}
+	for _, service := range services {
+		logInfo("Restarting %s...", service)
+		if err := restartContainer(service, containerType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
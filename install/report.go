@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// Report is the shared result type of the installer subcommands. It is printed as
+// text or JSON depending on --report-format so every command is machine readable.
+type Report struct {
+	Command  string
+	Success  bool
+	Message  string
+	Columns  []string
+	Rows     [][]string
+	Checks   []ReportCheck
+	Warnings []string
+	Error    string
+}
+
+// ReportCheck is a single pass/fail check within a report. A skipped check could not be run
+// and is neither a pass nor a failure.
+type ReportCheck struct {
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+func newReport(command string) *Report {
+	return &Report{Command: command}
+}
+
+// AddRow appends a table row, values are matched to Columns by position
+func (r *Report) AddRow(values ...string) {
+	r.Rows = append(r.Rows, values)
+}
+
+// AddCheck records the outcome of a single check
+func (r *Report) AddCheck(name string, passed bool, detail string) {
+	r.Checks = append(r.Checks, ReportCheck{Name: name, Passed: passed, Detail: detail})
+}
+
+// AddSkipped records a check that could not be run
+func (r *Report) AddSkipped(name string, detail string) {
+	r.Checks = append(r.Checks, ReportCheck{Name: name, Skipped: true, Detail: detail})
+}
+
+// Warn records a non-fatal warning
+func (r *Report) Warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Finish marks the report as successful unless err is set
+func (r *Report) Finish(err error) {
+	r.Success = err == nil
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// Print writes the report to stdout in the format selected by --report-format
+func (r *Report) Print() {
+	if *reportFormatFlag == "json" {
+		r.printJSON()
+		return
+	}
+	r.printText()
+}
+
+func (r *Report) printText() {
+	if len(r.Rows) > 0 {
+		writer := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(writer, strings.ToUpper(strings.Join(r.Columns, "\t")))
+		for _, row := range r.Rows {
+			fmt.Fprintln(writer, strings.Join(row, "\t"))
+		}
+		writer.Flush()
+	}
+
+	for _, check := range r.Checks {
+		status := "PASS"
+		switch {
+		case check.Skipped:
+			status = "SKIP"
+		case !check.Passed:
+			status = "FAIL"
+		}
+		if check.Detail != "" {
+			fmt.Printf("[%s] %s: %s\n", status, check.Name, check.Detail)
+		} else {
+			fmt.Printf("[%s] %s\n", status, check.Name)
+		}
+	}
+
+	for _, warning := range r.Warnings {
+		fmt.Printf("Warning: %s\n", warning)
+	}
+
+	if r.Message != "" {
+		fmt.Println(r.Message)
+	}
+	if r.Error != "" {
+		fmt.Printf("Error: %s\n", r.Error)
+	}
+}
+
+func (r *Report) printJSON() {
+	items := make([]map[string]string, 0, len(r.Rows))
+	for _, row := range r.Rows {
+		item := make(map[string]string)
+		for i, column := range r.Columns {
+			if i < len(row) {
+				item[column] = row[i]
+			}
+		}
+		items = append(items, item)
+	}
+
+	output := struct {
+		Command  string              `json:"command"`
+		Success  bool                `json:"success"`
+		Message  string              `json:"message,omitempty"`
+		Items    []map[string]string `json:"items"`
+		Checks   []ReportCheck       `json:"checks"`
+		Warnings []string            `json:"warnings"`
+		Error    string              `json:"error,omitempty"`
+	}{
+		Command:  r.Command,
+		Success:  r.Success,
+		Message:  r.Message,
+		Items:    items,
+		Checks:   r.Checks,
+		Warnings: r.Warnings,
+		Error:    r.Error,
+	}
+	if output.Checks == nil {
+		output.Checks = []ReportCheck{}
+	}
+	if output.Warnings == nil {
+		output.Warnings = []string{}
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(output)
+}
@@ -0,0 +1,43 @@
+package main
+
+import "fmt"
+
+const (
+	gigabyte = 1 << 30
+
+	// recommended resources of Pangolin, Gerbil and Traefik
+	minMemoryBytes = 2 * gigabyte
+	minDiskBytes   = 5 * gigabyte
+	// CrowdSec and its parsers need this much on top
+	crowdsecMemoryBytes = 1 * gigabyte
+	crowdsecDiskBytes   = 2 * gigabyte
+)
+
+// checkSystemResources compares the total memory and the free disk space of the working
+// directory with the recommended minimums and returns a warning for each one that falls short.
+// The thresholds are raised when --install-crowdsec is given.
+func checkSystemResources() []string {
+	wantMemory, wantDisk := uint64(minMemoryBytes), uint64(minDiskBytes)
+	if *installCrowdsecFlag {
+		wantMemory += crowdsecMemoryBytes
+		wantDisk += crowdsecDiskBytes
+	}
+
+	var warnings []string
+	if memory, err := totalMemoryBytes(); err != nil {
+		logInfo("Could not determine the system memory: %v", err)
+	} else if memory < wantMemory {
+		warnings = append(warnings, fmt.Sprintf("the system has %s of memory, at least %s is recommended", formatBytes(memory), formatBytes(wantMemory)))
+	}
+	if disk, err := freeDiskBytes("."); err != nil {
+		logInfo("Could not determine the free disk space: %v", err)
+	} else if disk < wantDisk {
+		warnings = append(warnings, fmt.Sprintf("only %s of disk space is free in the working directory, at least %s is recommended", formatBytes(disk), formatBytes(wantDisk)))
+	}
+	return warnings
+}
+
+// formatBytes renders a byte count in GB with one decimal
+func formatBytes(n uint64) string {
+	return fmt.Sprintf("%.1f GB", float64(n)/gigabyte)
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+package main
+
+import "fmt"
+
+// totalMemoryBytes is only implemented on Linux
+func totalMemoryBytes() (uint64, error) {
+	return 0, fmt.Errorf("not supported on this platform")
+}
+
+// freeDiskBytes is only implemented on Linux
+func freeDiskBytes(path string) (uint64, error) {
+	return 0, fmt.Errorf("not supported on this platform")
+}
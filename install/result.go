@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// installResult is the --result-file summary of an install run, written on success and failure
+type installResult struct {
+	Success           bool     `json:"success"`
+	Error             string   `json:"error,omitempty"`
+	PangolinVersion   string   `json:"pangolin_version,omitempty"`
+	GerbilVersion     string   `json:"gerbil_version,omitempty"`
+	BadgerVersion     string   `json:"badger_version,omitempty"`
+	BaseDomain        string   `json:"base_domain,omitempty"`
+	DashboardDomain   string   `json:"dashboard_domain,omitempty"`
+	CrowdSecInstalled bool     `json:"crowdsec_installed"`
+	ContainersStarted bool     `json:"containers_started"`
+	Warnings          []string `json:"warnings"`
+}
+
+// resultState collects the install result while main runs. Nothing is recorded or
+// written before startResult is called, so the subcommands never write a result file.
+var resultState = struct {
+	sync.Mutex
+	started bool
+	written bool
+	result  installResult
+}{}
+
+// startResult begins collecting the install result when --result-file is set
+func startResult() {
+	resultState.Lock()
+	defer resultState.Unlock()
+	resultState.started = *resultFileFlag != ""
+}
+
+// recordResult updates the collected install result
+func recordResult(update func(result *installResult)) {
+	resultState.Lock()
+	defer resultState.Unlock()
+	if resultState.started {
+		update(&resultState.result)
+	}
+}
+
+// recordResultConfig records the versions and domains that are deployed
+func recordResultConfig(config Config) {
+	recordResult(func(result *installResult) {
+		result.PangolinVersion = config.PangolinVersion
+		result.GerbilVersion = config.GerbilVersion
+		result.BadgerVersion = config.BadgerVersion
+		result.BaseDomain = config.BaseDomain
+		result.DashboardDomain = config.DashboardDomain
+	})
+}
+
+// recordResultLog keeps the warnings and the last error of the log output for the result file
+func recordResultLog(level, message string) {
+	message = strings.TrimSpace(message)
+	recordResult(func(result *installResult) {
+		switch level {
+		case "warn":
+			result.Warnings = append(result.Warnings, strings.TrimPrefix(message, "Warning: "))
+		case "error":
+			result.Error = strings.TrimPrefix(message, "Error: ")
+		}
+	})
+}
+
+// writeResultFile writes the collected install result to --result-file once. The run
+// succeeded when it exits with code 0 and no error was logged.
+func writeResultFile(code int) {
+	resultState.Lock()
+	defer resultState.Unlock()
+	if !resultState.started || resultState.written {
+		return
+	}
+	resultState.written = true
+
+	result := resultState.result
+	if code != 0 && result.Error == "" {
+		result.Error = fmt.Sprintf("the installer exited with code %d", code)
+	}
+	result.Success = code == 0 && result.Error == ""
+	if result.Warnings == nil {
+		result.Warnings = []string{}
+	}
+
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		logError("Error: could not encode the result file: %v", err)
+		return
+	}
+	if err := os.WriteFile(*resultFileFlag, append(data, '\n'), 0600); err != nil {
+		logError("Error: could not write the result file: %v", err)
+	}
+}
+
+// exit writes the result file and exits with code
+func exit(code int) {
+	writeResultFile(code)
+	os.Exit(code)
+}
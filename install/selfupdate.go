@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// installerRepo publishes the installer binaries with every Pangolin release
+const installerRepo = "pangolin"
+
+// releaseAsset is a downloadable file of a GitHub release
+type releaseAsset struct {
+	Name        string `json:"name"`
+	DownloadURL string `json:"browser_download_url"`
+	// Digest is "sha256:<hex>", GitHub computes it for every uploaded asset
+	Digest string `json:"digest"`
+}
+
+// selfUpdate replaces the running installer with the build of the latest release for this
+// machine when that release is newer. The download is verified against its SHA-256 checksum
+// and swapped in with a rename, so an interrupted update leaves the old binary in place.
+func selfUpdate() error {
+	if runtime.GOOS != "linux" {
+		return fmt.Errorf("installer builds are only published for Linux")
+	}
+	arch, err := detectArch()
+	if err != nil {
+		return err
+	}
+	if arch != "amd64" && arch != "arm64" {
+		return fmt.Errorf("installer builds are only published for amd64 and arm64, not %s", arch)
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("could not find the running installer: %v", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return fmt.Errorf("could not find the running installer: %v", err)
+	}
+
+	// Staging the download next to the binary checks that it can be replaced and keeps
+	// the final rename on one filesystem
+	staged, err := os.CreateTemp(filepath.Dir(executable), ".installer-update-")
+	if err != nil {
+		return fmt.Errorf("%s is not writable, rerun with permission to replace it: %v", executable, err)
+	}
+	defer os.Remove(staged.Name())
+	defer staged.Close()
+
+	var current Config
+	loadVersions(&current)
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	var release struct {
+		TagName string         `json:"tag_name"`
+		Assets  []releaseAsset `json:"assets"`
+	}
+	if err := getJSON(client, fmt.Sprintf(githubReleaseURL, installerRepo), &release); err != nil {
+		return fmt.Errorf("could not fetch the latest installer release: %v", err)
+	}
+	switch result, ok := compareVersions(current.PangolinVersion, release.TagName); {
+	case !ok:
+		logWarn("Warning: could not compare this installer's version %s with the release %s, updating anyway.", current.PangolinVersion, release.TagName)
+	case result >= 0:
+		logInfo("The installer is up to date (%s, latest release %s).", current.PangolinVersion, release.TagName)
+		return nil
+	}
+
+	name := "installer_linux_" + arch
+	var binary *releaseAsset
+	for i := range release.Assets {
+		if release.Assets[i].Name == name {
+			binary = &release.Assets[i]
+		}
+	}
+	if binary == nil {
+		return fmt.Errorf("release %s has no %s build", release.TagName, name)
+	}
+	checksum, err := releaseChecksum(client, release.Assets, *binary)
+	if err != nil {
+		return err
+	}
+
+	logInfo("Downloading the %s installer from %s...", release.TagName, binary.DownloadURL)
+	download := &http.Client{Timeout: 5 * time.Minute}
+	resp, err := download.Get(binary.DownloadURL)
+	if err != nil {
+		return fmt.Errorf("failed to download the installer: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download the installer: %s returned %s", binary.DownloadURL, resp.Status)
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(staged, hash), resp.Body); err != nil {
+		return fmt.Errorf("failed to download the installer: %v", err)
+	}
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != checksum {
+		return fmt.Errorf("the checksum of the downloaded installer is %s, expected %s, keeping the current installer", sum, checksum)
+	}
+	if err := staged.Close(); err != nil {
+		return fmt.Errorf("failed to write the installer: %v", err)
+	}
+	if err := os.Chmod(staged.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to make the installer executable: %v", err)
+	}
+	if err := os.Rename(staged.Name(), executable); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", executable, err)
+	}
+
+	logInfo("Updated the installer from %s to %s.", current.PangolinVersion, release.TagName)
+	return nil
+}
+
+// releaseChecksum returns the expected SHA-256 of binary, from the digest GitHub records for
+// the asset or from a checksum file of the release. It fails when neither is available.
+func releaseChecksum(client *http.Client, assets []releaseAsset, binary releaseAsset) (string, error) {
+	if sum, found := strings.CutPrefix(binary.Digest, "sha256:"); found {
+		return strings.ToLower(sum), nil
+	}
+
+	for _, asset := range assets {
+		if asset.Name != binary.Name+".sha256" && asset.Name != "checksums.txt" && asset.Name != "SHA256SUMS" {
+			continue
+		}
+		resp, err := client.Get(asset.DownloadURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to download %s: %v", asset.Name, err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to download %s: %s", asset.Name, resp.Status)
+		}
+
+		// Lines are "<sha256>  <file>", a .sha256 file may hold only the checksum
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 1 && asset.Name == binary.Name+".sha256" {
+				return strings.ToLower(fields[0]), nil
+			}
+			if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == binary.Name {
+				return strings.ToLower(fields[0]), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("the release publishes no checksum for %s, refusing to install it unverified", binary.Name)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// siteDomain is one entry of the domains section of config.yml
+type siteDomain struct {
+	Key    string
+	Domain string
+}
+
+// SiteDomainEntries returns the additional site domains with their config.yml keys, which
+// continue after the base domain as domain2, domain3, ...
+func (c Config) SiteDomainEntries() []siteDomain {
+	entries := make([]siteDomain, 0, len(c.SiteDomains))
+	for i, domain := range c.SiteDomains {
+		entries = append(entries, siteDomain{Key: "domain" + strconv.Itoa(i+2), Domain: domain})
+	}
+	return entries
+}
+
+// validateSiteDomains checks the additional site domains. A domain inside the base domain
+// is already served by it and a domain listed twice would create two entries for it.
+func validateSiteDomains(sites []string, baseDomain string) error {
+	seen := make(map[string]bool)
+	for _, site := range sites {
+		if ok, msg := validateDomain(site); !ok {
+			return fmt.Errorf("invalid site domain %q: %s", site, msg)
+		}
+		if isSubdomainOf(site, baseDomain) {
+			return fmt.Errorf("the site domain %s is already covered by the base domain %s", site, baseDomain)
+		}
+		if seen[strings.ToLower(site)] {
+			return fmt.Errorf("the site domain %s is listed twice", site)
+		}
+		seen[strings.ToLower(site)] = true
+	}
+	return nil
+}
+
+// splitSiteDomains splits a comma separated list of domains, dropping empty entries
+func splitSiteDomains(value string) []string {
+	var sites []string
+	for _, site := range strings.Split(value, ",") {
+		if site = strings.TrimSpace(site); site != "" {
+			sites = append(sites, site)
+		}
+	}
+	return sites
+}
+
+// readSiteDomains prompts for the additional site domains until the list is valid
+func readSiteDomains(reader *bufio.Reader, baseDomain string, defaults []string) []string {
+	for {
+		input := readString(reader, "Enter additional domains for your resources, comma separated (optional)", strings.Join(defaults, ","))
+		sites := splitSiteDomains(input)
+		err := validateSiteDomains(sites, baseDomain)
+		if err == nil || stdinClosed {
+			return sites
+		}
+		fmt.Printf("Invalid value: %v\n", err)
+	}
+}
+
+// installedSiteDomains returns the domains of an installed config.yml after domain1, in the
+// order of their keys
+func installedSiteDomains(domains map[string]string) []string {
+	var keys []int
+	for key := range domains {
+		n, err := strconv.Atoi(strings.TrimPrefix(key, "domain"))
+		if err != nil || n < 2 {
+			continue
+		}
+		keys = append(keys, n)
+	}
+	sort.Ints(keys)
+
+	sites := make([]string, 0, len(keys))
+	for _, n := range keys {
+		sites = append(sites, domains["domain"+strconv.Itoa(n)])
+	}
+	return sites
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// commonSMTPPorts are the usual SMTP submission ports, others are allowed with a warning
+var commonSMTPPorts = map[int]bool{25: true, 465: true, 587: true, 2525: true}
+
+// smtpDialTimeout bounds how long testSMTPConnection waits for the server
+const smtpDialTimeout = 5 * time.Second
+
+// testSMTPConnection connects to the configured SMTP server, upgrades the connection
+// with STARTTLS and authenticates with the configured credentials
+func testSMTPConnection(config Config) error {
+	addr := net.JoinHostPort(config.EmailSMTPHost, strconv.Itoa(config.EmailSMTPPort))
+
+	conn, err := net.DialTimeout("tcp", addr, smtpDialTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %v", addr, err)
+	}
+	// Keep a slow or silent server from hanging the handshake
+	conn.SetDeadline(time.Now().Add(3 * smtpDialTimeout))
+
+	tlsConfig := &tls.Config{ServerName: config.EmailSMTPHost}
+
+	// Port 465 expects TLS from the first byte instead of STARTTLS
+	implicitTLS := config.EmailSMTPPort == 465
+	if implicitTLS {
+		conn = tls.Client(conn, tlsConfig)
+	}
+
+	client, err := smtp.NewClient(conn, config.EmailSMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake with %s failed: %v", addr, err)
+	}
+	defer client.Close()
+
+	if !implicitTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("%s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS with %s failed: %v", addr, err)
+		}
+	}
+
+	if config.EmailSMTPUser != "" {
+		auth := smtp.PlainAuth("", config.EmailSMTPUser, config.EmailSMTPPass, config.EmailSMTPHost)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("authentication as %s failed: %v", config.EmailSMTPUser, err)
+		}
+	}
+
+	return client.Quit()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// summaryField is one answer of collectUserInput that can be changed from the summary
+type summaryField struct {
+	Label string
+	Value func(config *Config) string
+	Edit  func(reader *bufio.Reader, config *Config)
+	// Shown reports whether the field applies, nil means always
+	Shown func(config *Config) bool
+}
+
+// summaryFields lists the answers of collectUserInput in the order they were asked
+var summaryFields = []summaryField{
+	{
+		Label: "Base domain",
+		Value: func(config *Config) string { return config.BaseDomain },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.BaseDomain = readValidatedString(reader, "Enter your base domain (no subdomain e.g. example.com)", config.BaseDomain, validateDomain)
+			// A dashboard outside the new base domain has to be confirmed again
+			if !isSubdomainOf(config.DashboardDomain, config.BaseDomain) {
+				config.DashboardDomain = readDashboardDomain(reader, config.BaseDomain, "pangolin."+config.BaseDomain)
+			}
+		},
+	},
+	{
+		Label: "Dashboard domain",
+		Value: func(config *Config) string { return config.DashboardDomain },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.DashboardDomain = readDashboardDomain(reader, config.BaseDomain, config.DashboardDomain)
+		},
+	},
+	{
+		Label: "Additional domains",
+		Value: func(config *Config) string {
+			if len(config.SiteDomains) == 0 {
+				return "none"
+			}
+			return strings.Join(config.SiteDomains, ", ")
+		},
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.SiteDomains = readSiteDomains(reader, config.BaseDomain, config.SiteDomains)
+		},
+	},
+	{
+		Label: "Let's Encrypt email",
+		Value: func(config *Config) string { return config.LetsEncryptEmail },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.LetsEncryptEmail = readLetsEncryptEmail(reader, config.LetsEncryptEmail)
+		},
+	},
+	{
+		Label: "Certificate challenge",
+		Value: func(config *Config) string {
+			if config.AcmeChallenge == acmeDNSChallenge {
+				return "DNS-01 (" + config.DNSProvider + ", wildcard)"
+			}
+			return "HTTP-01"
+		},
+		Edit: collectAcmeConfig,
+	},
+	{
+		Label: "Gerbil tunneling",
+		Value: func(config *Config) string { return yesNo(config.InstallGerbil) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.InstallGerbil = readBool(reader, "Do you want to use Gerbil to allow tunneled connections", config.InstallGerbil)
+		},
+	},
+	{
+		Label: "Email (SMTP)",
+		Value: func(config *Config) string { return yesNo(config.EnableEmail) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			wasEnabled := config.EnableEmail
+			config.EnableEmail = readBool(reader, "Enable email functionality (SMTP)", config.EnableEmail)
+			if config.EnableEmail && !wasEnabled {
+				collectEmailConfig(reader, config)
+			}
+		},
+	},
+	{
+		Label: "SMTP host",
+		Value: func(config *Config) string { return config.EmailSMTPHost },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EmailSMTPHost = readString(reader, "Enter SMTP host", config.EmailSMTPHost)
+		},
+		Shown: emailEnabled,
+	},
+	{
+		Label: "SMTP port",
+		Value: func(config *Config) string { return strconv.Itoa(config.EmailSMTPPort) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EmailSMTPPort = readIntInRange(reader, "Enter SMTP port", config.EmailSMTPPort, 1, 65535)
+			if !commonSMTPPorts[config.EmailSMTPPort] {
+				logWarn("Warning: %d is not a common SMTP port (25, 465, 587 or 2525), make sure it is correct.", config.EmailSMTPPort)
+			}
+		},
+		Shown: emailEnabled,
+	},
+	{
+		Label: "SMTP username",
+		Value: func(config *Config) string { return config.EmailSMTPUser },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EmailSMTPUser = readString(reader, "Enter SMTP username", config.EmailSMTPUser)
+		},
+		Shown: emailEnabled,
+	},
+	{
+		Label: "SMTP password",
+		Value: func(config *Config) string { return maskSecret(config.EmailSMTPPass) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EmailSMTPPass = readPassword("Enter SMTP password", reader)
+		},
+		Shown: emailEnabled,
+	},
+	{
+		Label: "No-reply address",
+		Value: func(config *Config) string { return config.EmailNoReply },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EmailNoReply = readValidatedString(reader, "Enter no-reply email address", config.EmailNoReply, validateEmail)
+		},
+		Shown: emailEnabled,
+	},
+	{
+		Label: "CrowdSec",
+		Value: func(config *Config) string { return yesNo(config.InstallCrowdsec) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.InstallCrowdsec = readBool(reader, "Do you want to install CrowdSec and manage it yourself?", config.InstallCrowdsec)
+		},
+	},
+	{
+		Label: "IPv6",
+		Value: func(config *Config) string { return yesNo(config.EnableIPv6) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EnableIPv6 = readBool(reader, "Is your server IPv6 capable?", config.EnableIPv6)
+		},
+	},
+	{
+		Label: "Geoblocking database",
+		Value: func(config *Config) string { return yesNo(config.EnableGeoblocking) },
+		Edit: func(reader *bufio.Reader, config *Config) {
+			config.EnableGeoblocking = readBool(reader, "Do you want to download the MaxMind GeoLite2 database for geoblocking functionality?", config.EnableGeoblocking)
+		},
+	},
+	{
+		Label: "Database",
+		Value: func(config *Config) string {
+			if config.DbBackend == dbBackendPostgres {
+				return "PostgreSQL (" + config.PostgresUser + "@" + config.PostgresHost + ":" + strconv.Itoa(config.PostgresPort) + "/" + config.PostgresDB + ")"
+			}
+			return "SQLite"
+		},
+		Edit: func(reader *bufio.Reader, config *Config) {
+			postgres := config.DbBackend == dbBackendPostgres
+			if readBool(reader, "Do you want to use an external PostgreSQL database instead of SQLite?", postgres) == postgres {
+				// Unchanged, the PostgreSQL settings stay as they were
+				return
+			}
+			config.DbBackend = dbBackendSQLite
+			if !postgres {
+				config.DbBackend = dbBackendPostgres
+				collectPostgresConfig(reader, config)
+			}
+		},
+	},
+}
+
+func emailEnabled(config *Config) bool {
+	return config.EnableEmail
+}
+
+func yesNo(value bool) string {
+	if value {
+		return "yes"
+	}
+	return "no"
+}
+
+// reviewConfig prints the collected answers as a numbered list and lets the user
+// re-enter single answers until they confirm with an empty input
+func reviewConfig(reader *bufio.Reader, config *Config) {
+	// The defaults were accepted without asking, there is nothing to review
+	if *yesFlag {
+		return
+	}
+	for {
+		logStep("Summary")
+
+		var shown []summaryField
+		for _, field := range summaryFields {
+			if field.Shown != nil && !field.Shown(config) {
+				continue
+			}
+			shown = append(shown, field)
+			fmt.Printf("%2d) %-22s %s\n", len(shown), field.Label+":", field.Value(config))
+		}
+
+		input := readString(reader, "Enter a number to change that answer, or press Enter to continue", "")
+		if input == "" || stdinClosed {
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSuffix(input, ")"))
+		if err != nil || n < 1 || n > len(shown) {
+			fmt.Printf("Invalid value: enter a number between 1 and %d\n", len(shown))
+			continue
+		}
+		shown[n-1].Edit(reader, config)
+	}
+}
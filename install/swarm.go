@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// swarmStackName is the stack name used for docker stack deploy
+const swarmStackName = "pangolin"
+
+// isSwarmActive checks if the local Docker engine is part of an active swarm
+func isSwarmActive() bool {
+	cmd := exec.Command("docker", "info", "--format", "{{.Swarm.LocalNodeState}}")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+	return strings.TrimSpace(out.String()) == "active"
+}
+
+// swarmServiceName returns the swarm service name for a compose service
+func swarmServiceName(service string) string {
+	return swarmStackName + "_" + service
+}
+
+// isSwarmServiceRunning checks that all replicas of a stack service are up
+func isSwarmServiceRunning(service string) bool {
+	cmd := exec.Command("docker", "service", "ls", "--filter", "name="+swarmServiceName(service), "--format", "{{.Name}} {{.Replicas}}")
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	if err := cmd.Run(); err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != swarmServiceName(service) {
+			continue
+		}
+		// Replicas looks like "1/1", optionally followed by extra details
+		running, desired, ok := strings.Cut(fields[1], "/")
+		return ok && running == desired && running != "0"
+	}
+	return false
+}
+
+// convertComposeForSwarm rewrites a generated compose file so it can be used with docker stack deploy
+func convertComposeForSwarm(composePath string) error {
+	data, err := os.ReadFile(composePath)
+	if err != nil {
+		return fmt.Errorf("error reading compose file: %w", err)
+	}
+
+	var compose map[string]interface{}
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return fmt.Errorf("error parsing compose file: %w", err)
+	}
+
+	services, ok := compose["services"].(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("services section not found or invalid")
+	}
+
+	if _, ok := services["gerbil"]; ok {
+		return fmt.Errorf("swarm mode does not support Gerbil: Traefik has to share Gerbil's network namespace, which swarm services cannot do")
+	}
+
+	for name, value := range services {
+		service, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("service %s has an invalid format", name)
+		}
+
+		// Options ignored or rejected by docker stack deploy
+		delete(service, "container_name")
+		delete(service, "restart")
+		delete(service, "depends_on")
+
+		service["deploy"] = map[string]interface{}{
+			"replicas": 1,
+			"restart_policy": map[string]interface{}{
+				"condition": "any",
+			},
+			// Bind mounts point at the local config directory, so keep everything on this manager
+			"placement": map[string]interface{}{
+				"constraints": []interface{}{"node.role == manager"},
+			},
+		}
+
+		// Publish ports in host mode so Traefik sees the real client addresses
+		if ports, ok := service["ports"].([]interface{}); ok {
+			var hostPorts []interface{}
+			for _, port := range ports {
+				hostPort, err := swarmHostPort(fmt.Sprint(port))
+				if err != nil {
+					return fmt.Errorf("service %s: %v", name, err)
+				}
+				hostPorts = append(hostPorts, hostPort)
+			}
+			service["ports"] = hostPorts
+		}
+	}
+
+	// docker stack deploy does not accept the project name and needs an overlay network
+	delete(compose, "name")
+	compose["version"] = "3.8"
+	if networks, ok := compose["networks"].(map[string]interface{}); ok {
+		if defaultNetwork, ok := networks["default"].(map[string]interface{}); ok {
+			defaultNetwork["driver"] = "overlay"
+			defaultNetwork["attachable"] = true
+		}
+	}
+
+	newData, err := MarshalYAMLWithIndent(compose, 2)
+	if err != nil {
+		return fmt.Errorf("error marshaling swarm compose file: %w", err)
+	}
+
+	if err := os.WriteFile(composePath, newData, 0644); err != nil {
+		return fmt.Errorf("error writing swarm compose file: %w", err)
+	}
+
+	return nil
+}
+
+// swarmHostPort converts a short port mapping like "443:443" or "51820:51820/udp" to the long host-mode syntax
+func swarmHostPort(mapping string) (map[string]interface{}, error) {
+	ports, protocol, hasProtocol := strings.Cut(mapping, "/")
+	if !hasProtocol {
+		protocol = "tcp"
+	}
+
+	published, target, ok := strings.Cut(ports, ":")
+	if !ok {
+		target = published
+	}
+
+	publishedPort, err := strconv.Atoi(published)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported port mapping %q", mapping)
+	}
+	targetPort, err := strconv.Atoi(target)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported port mapping %q", mapping)
+	}
+
+	return map[string]interface{}{
+		"target":    targetPort,
+		"published": publishedPort,
+		"protocol":  protocol,
+		"mode":      "host",
+	}, nil
+}
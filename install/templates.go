@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// templateFuncs are available to every config template
+var templateFuncs = template.FuncMap{
+	// default returns value unless it is empty, e.g. {{.EmailSMTPUser | default "pangolin"}}
+	"default": func(fallback interface{}, value interface{}) interface{} {
+		if value == nil || reflect.ValueOf(value).IsZero() {
+			return fallback
+		}
+		if v := reflect.ValueOf(value); (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+			return fallback
+		}
+		return value
+	},
+	// quote renders a double quoted YAML string, escaping quotes, backslashes and control characters
+	"quote": func(value interface{}) string {
+		return strconv.Quote(fmt.Sprint(value))
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	// env reads an environment variable of the installer, e.g. {{env "HTTP_PROXY"}}
+	"env": os.Getenv,
+}
+
+// validateTemplates parses every config template in files, the embedded configFiles, so a broken
+// installer build fails before any question is asked instead of halfway through writing the config
+func validateTemplates(files fs.FS) error {
+	return fs.WalkDir(files, "config", func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || strings.Contains(path, ".DS_Store") {
+			return nil
+		}
+
+		content, err := fs.ReadFile(files, path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", path, err)
+		}
+		if _, err := template.New(d.Name()).Funcs(templateFuncs).Parse(string(content)); err != nil {
+			return fmt.Errorf("failed to parse template %s: %v", path, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("PANGOLIN_TEST_ENV", "from-env")
+
+	tests := []struct {
+		template string
+		data     interface{}
+		want     string
+	}{
+		{`{{.Value | default "fallback"}}`, map[string]interface{}{"Value": ""}, "fallback"},
+		{`{{.Value | default "fallback"}}`, map[string]interface{}{"Value": "set"}, "set"},
+		{`{{.Value | default 8080}}`, map[string]interface{}{"Value": 0}, "8080"},
+		{`{{.Value | default "none"}}`, map[string]interface{}{"Value": []string{}}, "none"},
+		{`{{.Value | default "none"}}`, map[string]interface{}{"Value": nil}, "none"},
+		{`{{.Value | quote}}`, map[string]interface{}{"Value": "plain"}, `"plain"`},
+		{`{{.Value | quote}}`, map[string]interface{}{"Value": `a"b\c` + "\n"}, `"a\"b\\c\n"`},
+		{`{{.Value | quote}}`, map[string]interface{}{"Value": 587}, `"587"`},
+		{`{{.Value | lower}}`, map[string]interface{}{"Value": "Example.COM"}, "example.com"},
+		{`{{.Value | upper}}`, map[string]interface{}{"Value": "info"}, "INFO"},
+		{`{{env "PANGOLIN_TEST_ENV"}}`, nil, "from-env"},
+		{`{{env "PANGOLIN_TEST_UNSET_ENV"}}`, nil, ""},
+	}
+
+	for _, tt := range tests {
+		tmpl, err := template.New("test").Funcs(templateFuncs).Parse(tt.template)
+		if err != nil {
+			t.Fatalf("parsing %s: %v", tt.template, err)
+		}
+		var out strings.Builder
+		if err := tmpl.Execute(&out, tt.data); err != nil {
+			t.Fatalf("executing %s with %v: %v", tt.template, tt.data, err)
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s with %v = %s, want %s", tt.template, tt.data, out.String(), tt.want)
+		}
+	}
+}
+
+func TestValidateTemplates(t *testing.T) {
+	if err := validateTemplates(configFiles); err != nil {
+		t.Errorf("the embedded templates do not parse: %v", err)
+	}
+
+	broken := fstest.MapFS{
+		"config/config.yml":                 {Data: []byte("secret: {{.Secret | quote}}\n")},
+		"config/traefik/traefik_config.yml": {Data: []byte("email: {{.LetsEncryptEmail\n")},
+	}
+	err := validateTemplates(broken)
+	if err == nil {
+		t.Fatal("validateTemplates accepted a broken template")
+	}
+	if !strings.Contains(err.Error(), "config/traefik/traefik_config.yml") {
+		t.Errorf("validateTemplates error %q does not name the broken template", err)
+	}
+
+	unknownFunc := fstest.MapFS{
+		"config/config.yml": {Data: []byte("secret: {{.Secret | base64}}\n")},
+	}
+	if err := validateTemplates(unknownFunc); err == nil {
+		t.Error("validateTemplates accepted a template calling an unknown function")
+	}
+}
+
+func TestRenderConfigFilesEscapesSpecialCharacters(t *testing.T) {
+	special := `a"b\c: #d 'e'`
+	config := defaultConfig()
+	config.BaseDomain = "example.com"
+	config.DashboardDomain = "pangolin.example.com"
+	config.LetsEncryptEmail = special
+	config.Secret = special
+	config.EnableEmail = true
+	config.EmailSMTPHost = special
+	config.EmailSMTPUser = special
+	config.EmailSMTPPass = special
+	config.EmailNoReply = special
+
+	dir := t.TempDir()
+	if err := renderConfigFiles(config, dir); err != nil {
+		t.Fatalf("renderConfigFiles: %v", err)
+	}
+
+	var app struct {
+		Server struct {
+			Secret string `yaml:"secret"`
+		} `yaml:"server"`
+		Email struct {
+			SMTPHost string `yaml:"smtp_host"`
+			SMTPUser string `yaml:"smtp_user"`
+			SMTPPass string `yaml:"smtp_pass"`
+			NoReply  string `yaml:"no_reply"`
+		} `yaml:"email"`
+	}
+	readYAML(t, filepath.Join(dir, "config/config.yml"), &app)
+	for name, got := range map[string]string{
+		"server.secret":   app.Server.Secret,
+		"email.smtp_host": app.Email.SMTPHost,
+		"email.smtp_user": app.Email.SMTPUser,
+		"email.smtp_pass": app.Email.SMTPPass,
+		"email.no_reply":  app.Email.NoReply,
+	} {
+		if got != special {
+			t.Errorf("config.yml %s = %q, want %q", name, got, special)
+		}
+	}
+
+	var traefik struct {
+		CertificatesResolvers map[string]struct {
+			Acme struct {
+				Email string `yaml:"email"`
+			} `yaml:"acme"`
+		} `yaml:"certificatesResolvers"`
+	}
+	readYAML(t, filepath.Join(dir, "config/traefik/traefik_config.yml"), &traefik)
+	if len(traefik.CertificatesResolvers) == 0 {
+		t.Fatal("traefik_config.yml has no certificate resolver")
+	}
+	for name, resolver := range traefik.CertificatesResolvers {
+		if resolver.Acme.Email != special {
+			t.Errorf("traefik_config.yml %s email = %q, want %q", name, resolver.Acme.Email, special)
+		}
+	}
+}
+
+func TestRenderConfigFilesAppEntrypointAndCommand(t *testing.T) {
+	config := defaultConfig()
+	config.BaseDomain = "example.com"
+	config.DashboardDomain = "pangolin.example.com"
+	config.LetsEncryptEmail = "admin@company.io"
+	config.Secret = generateRandomSecretKey(defaultSecretLength, defaultSecretCharset)
+	loadVersions(&config)
+	config.AppEntrypoint = []string{"/bin/sh", "-c"}
+	config.AppCommand = []string{`echo "it's up" && exec node dist/server.mjs`, `C:\path with spaces`, "--flag=a b"}
+
+	dir := t.TempDir()
+	if err := renderConfigFiles(config, dir); err != nil {
+		t.Fatalf("renderConfigFiles: %v", err)
+	}
+
+	var compose struct {
+		Services map[string]struct {
+			Entrypoint []string `yaml:"entrypoint"`
+			Command    []string `yaml:"command"`
+		} `yaml:"services"`
+	}
+	readYAML(t, filepath.Join(dir, "config/docker-compose.yml"), &compose)
+	pangolin, ok := compose.Services["pangolin"]
+	if !ok {
+		t.Fatal("docker-compose.yml has no pangolin service")
+	}
+	if !slices.Equal(pangolin.Entrypoint, config.AppEntrypoint) {
+		t.Errorf("entrypoint = %q, want %q", pangolin.Entrypoint, config.AppEntrypoint)
+	}
+	if !slices.Equal(pangolin.Command, config.AppCommand) {
+		t.Errorf("command = %q, want %q", pangolin.Command, config.AppCommand)
+	}
+}
+
+// readYAML parses the YAML file at path into out
+func readYAML(t *testing.T, path string, out interface{}) {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := yaml.Unmarshal(content, out); err != nil {
+		t.Fatalf("%s is not valid YAML: %v\n%s", path, err, content)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+
+	"golang.org/x/term"
+)
+
+// ANSI styles used for the status output
+const (
+	styleBold   = "\033[1m"
+	styleRed    = "\033[31m"
+	styleYellow = "\033[33m"
+	styleReset  = "\033[0m"
+)
+
+// isStdinTerminal reports whether the prompts are read from an interactive terminal
+func isStdinTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+// isStdoutTerminal reports whether the output is written to an interactive terminal
+func isStdoutTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// colorEnabled reports whether styled output may be used. Colors are off with --no-color,
+// a non-empty NO_COLOR (https://no-color.org), machine readable or tee'd output, or when
+// stdout is not a terminal.
+func colorEnabled() bool {
+	if *noColorFlag || os.Getenv("NO_COLOR") != "" || *jsonLogsFlag || *logFileFlag != "" {
+		return false
+	}
+	return isStdoutTerminal()
+}
+
+// styled wraps text in the given ANSI style if colors are enabled
+func styled(style, text string) string {
+	if !colorEnabled() {
+		return text
+	}
+	return style + text + styleReset
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// detectHostTimezone returns the IANA time zone of the host from TZ, /etc/timezone or the
+// /etc/localtime symlink, and an empty string when none of them names a valid zone
+func detectHostTimezone() string {
+	candidates := []string{strings.TrimPrefix(os.Getenv("TZ"), ":")}
+	if data, err := os.ReadFile("/etc/timezone"); err == nil {
+		candidates = append(candidates, strings.TrimSpace(string(data)))
+	}
+	// Distributions without /etc/timezone link /etc/localtime to /usr/share/zoneinfo/<zone>
+	if target, err := filepath.EvalSymlinks("/etc/localtime"); err == nil {
+		if _, zone, found := strings.Cut(target, "/zoneinfo/"); found {
+			candidates = append(candidates, zone)
+		}
+	}
+
+	for _, zone := range candidates {
+		if validateTimezone(zone) == nil {
+			return zone
+		}
+	}
+	return ""
+}
+
+// serviceTimezone returns the TZ a compose service sets, empty when it sets none
+func serviceTimezone(service interface{}) string {
+	settings, ok := service.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	environment, ok := settings["environment"].(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	zone, _ := environment["TZ"].(string)
+	return zone
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// uninstallPaths are removed by --uninstall when the user also wants the config gone
+var uninstallPaths = []string{
+	"config/letsencrypt",
+	"config/db",
+	"config",
+}
+
+// uninstall tears down the containers and optionally removes the generated files
+func uninstall(reader *bufio.Reader) error {
+	composeFile, err := composeFilePath()
+	if err != nil {
+		return err
+	}
+
+	containerType := detectContainerType()
+	if containerType == Undefined {
+		return fmt.Errorf("neither Docker nor Podman is installed")
+	}
+
+	// Check the paths before the stack is torn down, so a refusal leaves everything in place
+	var toRemove []string
+	for _, path := range append(uninstallPaths, composeFile) {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := checkInsideWorkingDir(path); err != nil {
+			if path == composeFile {
+				logInfo("Keeping %s, it is outside the working directory. Remove it yourself if it is no longer needed.", path)
+				continue
+			}
+			return err
+		}
+		toRemove = append(toRemove, path)
+	}
+
+	logStep("Removing containers")
+	if err := removeContainers(containerType, *removeVolumesFlag); err != nil {
+		return err
+	}
+
+	if len(toRemove) == 0 {
+		logInfo("No configuration files left to remove.")
+		return nil
+	}
+
+	logInfo("\nThe following paths will be removed:")
+	for _, path := range toRemove {
+		logInfo("  %s", path)
+	}
+
+	if !confirm(reader, "force", "Do you also want to delete the configuration, certificates and database?", false) {
+		logInfo("Keeping the configuration files.")
+		return nil
+	}
+
+	for _, path := range toRemove {
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		logInfo("Removed %s", path)
+	}
+
+	return nil
+}
+
+// rollbackInstall stops whatever a failed first install started and removes the files and
+// directories it created, leaving anything that existed before the install alone
+func rollbackInstall(containerType SupportedContainer) error {
+	if err := stopContainers(containerType); err != nil {
+		logWarn("Warning: %v", err)
+	}
+
+	// Check every path before removing any, so a refusal does not leave a half removed install
+	var toRemove []string
+	for _, path := range installCreatedPaths() {
+		if _, err := os.Lstat(path); err != nil {
+			continue
+		}
+		if err := checkInsideWorkingDir(path); err != nil {
+			if path == *composeFileFlag {
+				logWarn("Warning: keeping %s, it is outside the working directory. Remove it yourself if it is no longer needed.", path)
+				continue
+			}
+			return err
+		}
+		toRemove = append(toRemove, path)
+	}
+
+	for _, path := range toRemove {
+		// Removing a created directory removes its contents too
+		if slices.ContainsFunc(toRemove, func(dir string) bool { return strings.HasPrefix(path, dir+string(filepath.Separator)) }) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", path, err)
+		}
+		logInfo("Removed %s", path)
+	}
+	clearInstallState()
+	return nil
+}
+
+// checkInsideWorkingDir refuses paths that resolve outside the current working directory
+func checkInsideWorkingDir(path string) error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to determine working directory: %v", err)
+	}
+	wd, err = filepath.EvalSymlinks(wd)
+	if err != nil {
+		return fmt.Errorf("failed to resolve working directory: %v", err)
+	}
+
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	resolved, err = filepath.Abs(resolved)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+
+	rel, err := filepath.Rel(wd, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("refusing to remove %s: it resolves to %s, which is not inside %s", path, resolved, wd)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// githubReleaseURL is queried for the latest release of each component when no
+// --versions-url manifest is given
+const githubReleaseURL = "https://api.github.com/repos/fosrl/%s/releases/latest"
+
+// versionManifest is the format of the --versions-url document
+type versionManifest struct {
+	Pangolin string `json:"pangolin"`
+	Gerbil   string `json:"gerbil"`
+	Badger   string `json:"badger"`
+}
+
+// getJSON fetches url and decodes the JSON response into out
+func getJSON(client *http.Client, url string, out interface{}) error {
+	resp, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from %s: %v", url, err)
+	}
+	return nil
+}
+
+// fetchLatestVersions reads the manifest at manifestURL, or the latest GitHub releases if it is empty
+func fetchLatestVersions(manifestURL string) (versionManifest, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	var manifest versionManifest
+	if manifestURL != "" {
+		err := getJSON(client, manifestURL, &manifest)
+		return manifest, err
+	}
+
+	for _, component := range []struct {
+		repo    string
+		version *string
+	}{
+		{"pangolin", &manifest.Pangolin},
+		{"gerbil", &manifest.Gerbil},
+		{"badger", &manifest.Badger},
+	} {
+		var release struct {
+			TagName string `json:"tag_name"`
+		}
+		if err := getJSON(client, fmt.Sprintf(githubReleaseURL, component.repo), &release); err != nil {
+			return manifest, err
+		}
+		*component.version = release.TagName
+	}
+	return manifest, nil
+}
+
+// imageTag returns the version tag of an image reference like docker.io/fosrl/pangolin:1.2.3,
+// without the prefix of the PostgreSQL build of Pangolin or a pinned digest
+func imageTag(image string) string {
+	image, _, _ = strings.Cut(image, "@")
+	name := image[strings.LastIndex(image, "/")+1:]
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		return strings.TrimPrefix(name[i+1:], "postgresql-")
+	}
+	return "latest"
+}
+
+// checkUpdates fills the report with the deployed and the latest version of every component.
+// It only reads the installation and never changes it.
+func checkUpdates(report *Report) error {
+	images, err := composeImages(*composeFileFlag)
+	if err != nil {
+		return fmt.Errorf("%v, run this from the installation directory", err)
+	}
+
+	deployed := make(map[string]string)
+	for _, component := range []string{"pangolin", "gerbil"} {
+		if image, ok := images[component]; ok {
+			deployed[component] = imageTag(image)
+		}
+	}
+	if traefikConfig, err := ReadTraefikConfig("config/traefik/traefik_config.yml"); err == nil {
+		deployed["badger"] = traefikConfig.BadgerVersion
+	} else {
+		report.Warn("could not read the Badger version: %v", err)
+	}
+
+	source := *versionsURLFlag
+	if source == "" {
+		source = "GitHub releases"
+	}
+	latest, err := fetchLatestVersions(*versionsURLFlag)
+	if err != nil {
+		return fmt.Errorf("could not fetch the latest versions from %s: %v", source, err)
+	}
+
+	report.Columns = []string{"component", "deployed", "latest", "status"}
+	outdated, unknown := 0, 0
+	for _, component := range []struct {
+		name   string
+		latest string
+	}{
+		{"pangolin", latest.Pangolin},
+		{"gerbil", latest.Gerbil},
+		{"badger", latest.Badger},
+	} {
+		current, ok := deployed[component.name]
+		if !ok {
+			continue
+		}
+
+		status := "unknown"
+		result, ok := compareVersions(current, component.latest)
+		if !ok {
+			unknown++
+		} else {
+			switch {
+			case result < 0:
+				status = "update available"
+				outdated++
+			case result > 0:
+				status = "newer than latest"
+			default:
+				status = "up to date"
+			}
+		}
+		report.AddRow(component.name, current, component.latest, status)
+	}
+
+	if outdated > 0 {
+		report.Message = "Newer releases are available, download the latest installer and run it with --update to upgrade."
+	} else if unknown > 0 {
+		report.Message = "Some versions could not be compared, check them manually."
+	} else {
+		report.Message = "Everything is up to date."
+	}
+	return nil
+}
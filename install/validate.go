@@ -0,0 +1,325 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// reservedPorts are host or Traefik ports already used by the Pangolin stack
+var reservedPorts = map[int]string{
+	80:    "Traefik HTTP",
+	443:   "Traefik HTTPS",
+	3004:  "Gerbil API",
+	6060:  "CrowdSec metrics",
+	8080:  "Traefik API",
+	8443:  "Traefik HTTPS behind an external proxy",
+	8880:  "Traefik HTTP behind an external proxy",
+	21820: "Gerbil relay",
+	51820: "WireGuard",
+}
+
+// validateMetricsPort checks that the metrics port is usable and does not collide with the stack
+func validateMetricsPort(port int) error {
+	if port < 1 || port > 65535 {
+		return fmt.Errorf("metrics port %d is out of range (1-65535)", port)
+	}
+	if service, ok := reservedPorts[port]; ok {
+		return fmt.Errorf("metrics port %d collides with the %s port", port, service)
+	}
+	return nil
+}
+
+// parseIPList splits a comma separated list of IP addresses or CIDR ranges
+func parseIPList(value string) ([]string, error) {
+	var ips []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(item); err != nil && net.ParseIP(item) == nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR range: %s", item)
+		}
+		ips = append(ips, item)
+	}
+	return ips, nil
+}
+
+// validateDomain checks that value is a bare domain name like example.com and returns
+// a reason suitable for the user when it is not
+func validateDomain(value string) (bool, string) {
+	switch {
+	case value == "":
+		return false, "a domain is required"
+	case strings.Contains(value, "://"):
+		return false, "enter the domain without a protocol like https://"
+	case strings.ContainsAny(value, " \t"):
+		return false, "the domain must not contain spaces"
+	case strings.Contains(value, "/"):
+		return false, "enter the domain without a path or trailing slash"
+	case !strings.Contains(value, "."):
+		return false, "enter a fully qualified domain like example.com"
+	case len(value) > 253:
+		return false, "the domain is longer than 253 characters"
+	}
+
+	for _, label := range strings.Split(value, ".") {
+		if label == "" || len(label) > 63 {
+			return false, "each part of the domain must be between 1 and 63 characters"
+		}
+		if strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return false, "parts of the domain must not start or end with a hyphen"
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false, fmt.Sprintf("the domain contains an invalid character %q", r)
+			}
+		}
+	}
+
+	return true, ""
+}
+
+// validateBindAddress checks that value is an IP address of a local interface
+func validateBindAddress(value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return fmt.Errorf("%q is not an IP address", value)
+	}
+
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return fmt.Errorf("could not list the local addresses: %v", err)
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.Equal(ip) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not an address of a local interface", value)
+}
+
+// isSubdomainOf reports whether child equals parent or is a subdomain of it at any depth,
+// ignoring case and a trailing dot
+func isSubdomainOf(child, parent string) bool {
+	child = strings.ToLower(strings.TrimSuffix(child, "."))
+	parent = strings.ToLower(strings.TrimSuffix(parent, "."))
+	if parent == "" {
+		return false
+	}
+	return child == parent || strings.HasSuffix(child, "."+parent)
+}
+
+// normalizeRegistryPrefix strips the trailing slash of a registry prefix like
+// registry.example.com:5000/mirror and checks that it starts with a registry host
+func normalizeRegistryPrefix(value string) (string, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "/")
+	if strings.Contains(value, "://") {
+		return "", fmt.Errorf("%q: enter the registry without a protocol like https://", value)
+	}
+
+	host, path, _ := strings.Cut(value, "/")
+	name := host
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if n, err := strconv.Atoi(port); err != nil || n < 1 || n > 65535 {
+			return "", fmt.Errorf("%q: invalid port %q", value, port)
+		}
+		name = h
+	}
+	if name != "localhost" && net.ParseIP(name) == nil {
+		if ok, reason := validateDomain(name); !ok {
+			return "", fmt.Errorf("%q: %s", value, reason)
+		}
+	}
+
+	if path != "" {
+		for _, component := range strings.Split(path, "/") {
+			if component == "" || strings.Trim(component, "abcdefghijklmnopqrstuvwxyz0123456789._-") != "" {
+				return "", fmt.Errorf("%q: repository paths may only contain lowercase letters, digits, '.', '_' and '-'", value)
+			}
+		}
+	}
+
+	return value, nil
+}
+
+// validateEmail checks that value is a plain email address like admin@example.com and returns
+// a reason suitable for the user when it is not
+func validateEmail(value string) (bool, string) {
+	if value == "" {
+		return false, "an email address is required"
+	}
+
+	local, domain, found := strings.Cut(value, "@")
+	if !found || local == "" {
+		return false, "the email address must look like name@example.com"
+	}
+	if domain == "" || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return false, "the email address needs a domain like example.com after the @"
+	}
+
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return false, "the email address is not valid"
+	}
+
+	return true, ""
+}
+
+// disposableEmailDomains are throwaway mail providers. Mail to them is deleted after a short
+// while, so expiry notices from Let's Encrypt would never be read.
+var disposableEmailDomains = map[string]bool{
+	"10minutemail.com":  true,
+	"discard.email":     true,
+	"dispostable.com":   true,
+	"fakeinbox.com":     true,
+	"getnada.com":       true,
+	"guerrillamail.com": true,
+	"maildrop.cc":       true,
+	"mailinator.com":    true,
+	"mailnesia.com":     true,
+	"mintemail.com":     true,
+	"sharklasers.com":   true,
+	"temp-mail.org":     true,
+	"tempmail.com":      true,
+	"throwawaymail.com": true,
+	"trashmail.com":     true,
+	"yopmail.com":       true,
+}
+
+// placeholderEmailDomains are the documentation domains and reserved TLDs no mail arrives at
+var placeholderEmailDomains = []string{"example.com", "example.net", "example.org", "domain.com", "yourdomain.com", "example", "invalid", "localhost", "test"}
+
+// emailDomainTypos maps common misspellings of the large mail providers to the intended domain
+var emailDomainTypos = map[string]string{
+	"gamil.com":   "gmail.com",
+	"gmai.com":    "gmail.com",
+	"gmail.co":    "gmail.com",
+	"gmail.con":   "gmail.com",
+	"gmial.com":   "gmail.com",
+	"gnail.com":   "gmail.com",
+	"hotmai.com":  "hotmail.com",
+	"hotmail.con": "hotmail.com",
+	"hotmial.com": "hotmail.com",
+	"outlok.com":  "outlook.com",
+	"outlook.con": "outlook.com",
+	"yaho.com":    "yahoo.com",
+	"yahoo.con":   "yahoo.com",
+	"yahooo.com":  "yahoo.com",
+}
+
+// suspiciousEmail returns why a valid email address is likely to never be read, or "" when
+// nothing stands out
+func suspiciousEmail(value string) string {
+	_, domain, _ := strings.Cut(strings.ToLower(value), "@")
+	if disposableEmailDomains[domain] {
+		return domain + " is a disposable email provider"
+	}
+	if intended, ok := emailDomainTypos[domain]; ok {
+		return domain + " looks like a typo of " + intended
+	}
+	for _, placeholder := range placeholderEmailDomains {
+		if domain == placeholder || strings.HasSuffix(domain, "."+placeholder) {
+			return domain + " is a placeholder domain that receives no mail"
+		}
+	}
+	return ""
+}
+
+// parseSizeMB parses sizes like "100M", "1G" or "512K" and returns whole megabytes (at least 1)
+func parseSizeMB(value string) (int, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	multipliers := map[string]float64{"K": 1.0 / 1024, "KB": 1.0 / 1024, "M": 1, "MB": 1, "G": 1024, "GB": 1024}
+
+	number := strings.TrimRight(value, "KMGB")
+	multiplier, ok := multipliers[value[len(number):]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q: use a number with a K, M or G suffix", value)
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid size %q: use a number with a K, M or G suffix", value)
+	}
+
+	return int(math.Max(1, math.Ceil(size*multiplier))), nil
+}
+
+// parseDays parses ages like "14d" or Go durations like "72h" and returns whole days (at least 1)
+func parseDays(value string) (int, error) {
+	value = strings.TrimSpace(value)
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 1 {
+			return 0, fmt.Errorf("invalid age %q: use a positive number of days like 14d", value)
+		}
+		return n, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid age %q: use days like 14d or a duration like 72h", value)
+	}
+	return int(math.Max(1, math.Ceil(duration.Hours()/24))), nil
+}
+
+// splitArgs splits a command line into arguments, honoring single quotes, double quotes and backslash escapes
+func splitArgs(value string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(value)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == '\'':
+			current.WriteRune(r)
+		case r == '\\' && i+1 < len(runes):
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			current.WriteRune(r)
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
+
+// validateTimezone checks that value is an IANA time zone like Europe/Berlin
+func validateTimezone(value string) error {
+	// LoadLocation also accepts these, but they mean nothing inside a container
+	if value == "" || value == "Local" {
+		return fmt.Errorf("must be an IANA time zone like Europe/Berlin")
+	}
+	if _, err := time.LoadLocation(value); err != nil {
+		return fmt.Errorf("unknown time zone %q, it must be an IANA time zone like Europe/Berlin", value)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import "testing"
+
+func TestValidateDomain(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"example.com", true},
+		{"sub.example.com", true},
+		{"http://x.com", false},
+		{"localhost", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		valid, reason := validateDomain(tt.value)
+		if valid != tt.valid {
+			t.Errorf("validateDomain(%q) = %v, want %v", tt.value, valid, tt.valid)
+		}
+		if !valid && reason == "" {
+			t.Errorf("validateDomain(%q) gave no reason", tt.value)
+		}
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"admin@example.com", true},
+		{"first.last+tag@mail.example.co.uk", true},
+		{"", false},
+		{"admin", false},
+		{"@example.com", false},
+		{"admin@", false},
+		{"admin@localhost", false},
+		{"admin@.example.com", false},
+		{"admin@example.com.", false},
+		{"admin@exa mple.com", false},
+		{"Admin <admin@example.com>", false},
+	}
+
+	for _, tt := range tests {
+		valid, reason := validateEmail(tt.value)
+		if valid != tt.valid {
+			t.Errorf("validateEmail(%q) = %v, want %v", tt.value, valid, tt.valid)
+		}
+		if !valid && reason == "" {
+			t.Errorf("validateEmail(%q) gave no reason", tt.value)
+		}
+	}
+}
+
+func TestIsSubdomainOf(t *testing.T) {
+	tests := []struct {
+		child, parent string
+		want          bool
+	}{
+		{"example.com", "example.com", true},
+		{"pangolin.example.com", "example.com", true},
+		{"a.b.example.com", "example.com", true},
+		{"badexample.com", "example.com", false},
+		{"example.com.evil.net", "example.com", false},
+		{"example.com", "pangolin.example.com", false},
+		{"Pangolin.EXAMPLE.com", "example.COM", true},
+		{"pangolin.example.com.", "example.com", true},
+		{"pangolin.example.com", "example.com.", true},
+		{"example.com", "", false},
+		{"", "example.com", false},
+	}
+
+	for _, tt := range tests {
+		if got := isSubdomainOf(tt.child, tt.parent); got != tt.want {
+			t.Errorf("isSubdomainOf(%q, %q) = %v, want %v", tt.child, tt.parent, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTimezone(t *testing.T) {
+	tests := []struct {
+		value string
+		valid bool
+	}{
+		{"Europe/Berlin", true},
+		{"America/New_York", true},
+		{"UTC", true},
+		{"", false},
+		{"Local", false},
+		{"Europe/Atlantis", false},
+		{"CEST+2", false},
+		{"../../etc/passwd", false},
+	}
+
+	for _, tt := range tests {
+		err := validateTimezone(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("validateTimezone(%q) = %v, want valid %v", tt.value, err, tt.valid)
+		}
+	}
+}
+
+func TestSuspiciousEmail(t *testing.T) {
+	tests := []struct {
+		value      string
+		suspicious bool
+	}{
+		{"admin@example.com", true},
+		{"admin@mail.example.org", true},
+		{"Admin@Example.COM", true},
+		{"admin@mailinator.com", true},
+		{"admin@yourdomain.com", true},
+		{"admin@server.test", true},
+		{"admin@gmial.com", true},
+		{"admin@gmail.con", true},
+		{"admin@gmail.com", false},
+		{"jane.doe@company.io", false},
+		{"admin@notexample.com", false},
+	}
+
+	for _, tt := range tests {
+		reason := suspiciousEmail(tt.value)
+		if (reason != "") != tt.suspicious {
+			t.Errorf("suspiciousEmail(%q) = %q, want suspicious %v", tt.value, reason, tt.suspicious)
+		}
+	}
+}